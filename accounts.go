@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// defaultAccountName names the single account configured through
+// GOOGLE_OAUTH_CREDENTIALS when no profiles file is used.
+const defaultAccountName = "default"
+
+// account is one Google account the server acts for.
+type account struct {
+	name  string
+	tasks TasksService
+
+	// lists caches the account's task lists for resolving names to IDs, and
+	// defaultList the list that @default stands for
+	listsMu     sync.Mutex
+	lists       []TaskListItem
+	defaultList *TaskListItem
+}
+
+// profile names the OAuth client and token storage of one account.
+type profile struct {
+	Name        string `json:"name"`
+	Credentials string `json:"credentials"`
+	Token       string `json:"token"`
+
+	// Store selects the token store backend, Command the helper for "command"
+	Store   string `json:"store"`
+	Command string `json:"command"`
+}
+
+// profilesConfig is the file named by GOOGLE_TASKS_PROFILES.
+type profilesConfig struct {
+	Default  string    `json:"default"`
+	Profiles []profile `json:"profiles"`
+}
+
+// loadProfiles reads a profiles file. The default profile comes first in the
+// result. Relative paths are taken relative to the file, and a missing token
+// path defaults to <name>-token.json next to the credentials.
+func loadProfiles(path string) ([]profile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read profiles file: %v", err)
+	}
+
+	var config profilesConfig
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse profiles file: %v", err)
+	}
+	if len(config.Profiles) == 0 {
+		return nil, fmt.Errorf("profiles file %s defines no profiles", path)
+	}
+
+	dir := filepath.Dir(path)
+	seen := make(map[string]bool)
+	profiles := make([]profile, 0, len(config.Profiles))
+	for _, p := range config.Profiles {
+		if p.Name == "" || p.Credentials == "" {
+			return nil, fmt.Errorf("every profile needs a name and credentials")
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("duplicate profile %q", p.Name)
+		}
+		seen[p.Name] = true
+
+		if !filepath.IsAbs(p.Credentials) {
+			p.Credentials = filepath.Join(dir, p.Credentials)
+		}
+		if p.Token == "" {
+			p.Token = filepath.Join(filepath.Dir(p.Credentials), p.Name+"-token.json")
+		} else if !filepath.IsAbs(p.Token) {
+			p.Token = filepath.Join(dir, p.Token)
+		}
+
+		if p.Name == config.Default {
+			profiles = append([]profile{p}, profiles...)
+		} else {
+			profiles = append(profiles, p)
+		}
+	}
+
+	if config.Default != "" && !seen[config.Default] {
+		return nil, fmt.Errorf("default profile %q is not defined", config.Default)
+	}
+	return profiles, nil
+}
+
+// configuredProfiles returns the profiles from GOOGLE_TASKS_PROFILES, or a
+// single default profile from GOOGLE_OAUTH_CREDENTIALS and GOOGLE_TOKEN_FILE.
+// GOOGLE_TOKEN_STORE and GOOGLE_TOKEN_COMMAND apply to profiles that don't
+// choose a token store themselves.
+func configuredProfiles() ([]profile, error) {
+	if path := os.Getenv("GOOGLE_TASKS_PROFILES"); path != "" {
+		profiles, err := loadProfiles(path)
+		if err != nil {
+			return nil, err
+		}
+		for i := range profiles {
+			if profiles[i].Store == "" {
+				profiles[i].Store = os.Getenv("GOOGLE_TOKEN_STORE")
+				profiles[i].Command = os.Getenv("GOOGLE_TOKEN_COMMAND")
+			}
+		}
+		return profiles, nil
+	}
+
+	credentialsFile := os.Getenv("GOOGLE_OAUTH_CREDENTIALS")
+	if credentialsFile == "" {
+		return nil, fmt.Errorf("GOOGLE_OAUTH_CREDENTIALS or GOOGLE_TASKS_PROFILES environment variable must be set")
+	}
+
+	tokenFile := os.Getenv("GOOGLE_TOKEN_FILE")
+	if tokenFile == "" {
+		tokenFile = filepath.Join(filepath.Dir(credentialsFile), "tasks-token.json")
+	}
+
+	return []profile{{
+		Name:        defaultAccountName,
+		Credentials: credentialsFile,
+		Token:       tokenFile,
+		Store:       os.Getenv("GOOGLE_TOKEN_STORE"),
+		Command:     os.Getenv("GOOGLE_TOKEN_COMMAND"),
+	}}, nil
+}
+
+// findProfile returns the named profile, or the default one when name is empty.
+func findProfile(profiles []profile, name string) (profile, error) {
+	if name == "" {
+		return profiles[0], nil
+	}
+	for _, p := range profiles {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return profile{}, fmt.Errorf("unknown account %q (available: %s)", name, profileNames(profiles))
+}
+
+func profileNames(profiles []profile) string {
+	names := make([]string, len(profiles))
+	for i, p := range profiles {
+		names[i] = p.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+type accountKey struct{}
+
+// withAccount directs the task operations of a request at a.
+func withAccount(ctx context.Context, a *account) context.Context {
+	return context.WithValue(ctx, accountKey{}, a)
+}
+
+// account returns the account a request acts for, defaulting to the first one.
+func (s *Server) account(ctx context.Context) *account {
+	if a, ok := ctx.Value(accountKey{}).(*account); ok {
+		return a
+	}
+	return s.accounts[0]
+}
+
+// selectAccount picks the account named by a call's optional account argument.
+func (s *Server) selectAccount(args json.RawMessage) (*account, error) {
+	var input struct {
+		Account string `json:"account"`
+	}
+	if len(args) > 0 {
+		// Malformed arguments are reported by the tool handler itself
+		json.Unmarshal(args, &input)
+	}
+	return s.findAccount(input.Account)
+}
+
+// findAccount returns the named account, or the default one when name is empty.
+func (s *Server) findAccount(name string) (*account, error) {
+	if name == "" {
+		return s.accounts[0], nil
+	}
+	for _, a := range s.accounts {
+		if a.name == name {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown account %q (available: %s)", name, s.accountNames())
+}
+
+func (s *Server) accountNames() string {
+	names := make([]string, len(s.accounts))
+	for i, a := range s.accounts {
+		names[i] = a.name
+	}
+	return strings.Join(names, ", ")
+}
+
+func (s *Server) callListAccounts(id interface{}) *JSONRPCResponse {
+	var result string
+	accounts := make([]map[string]interface{}, 0, len(s.accounts))
+	for i, a := range s.accounts {
+		result += "- " + a.name
+		if i == 0 {
+			result += " (default)"
+		}
+		result += "\n"
+		accounts = append(accounts, map[string]interface{}{
+			"name":    a.name,
+			"default": i == 0,
+		})
+	}
+
+	return s.structuredResponse(id, result, map[string]interface{}{"accounts": accounts})
+}
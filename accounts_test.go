@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newMultiAccountServer(personal, work *fakeTasks) *Server {
+	return &Server{
+		accounts: []*account{
+			{name: "personal", tasks: personal},
+			{name: "work", tasks: work},
+		},
+		loc: time.UTC,
+	}
+}
+
+func callTool(s *Server, name string, args map[string]interface{}) *JSONRPCResponse {
+	params, _ := json.Marshal(map[string]interface{}{"name": name, "arguments": args})
+	return s.handleRequest(context.Background(), JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "tools/call", Params: params})
+}
+
+func TestLoadProfiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "profiles.json")
+	os.WriteFile(path, []byte(`{
+		"default": "work",
+		"profiles": [
+			{"name": "personal", "credentials": "personal/client.json", "token": "/abs/personal-token.json"},
+			{"name": "work", "credentials": "/etc/work/client.json"}
+		]
+	}`), 0600)
+
+	profiles, err := loadProfiles(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []profile{
+		{Name: "work", Credentials: "/etc/work/client.json", Token: "/etc/work/work-token.json"},
+		{Name: "personal", Credentials: filepath.Join(dir, "personal/client.json"), Token: "/abs/personal-token.json"},
+	}
+	if len(profiles) != len(expected) {
+		t.Fatalf("expected %d profiles, got %+v", len(expected), profiles)
+	}
+	for i := range expected {
+		if profiles[i] != expected[i] {
+			t.Errorf("profile %d: expected %+v, got %+v", i, expected[i], profiles[i])
+		}
+	}
+}
+
+func TestLoadProfiles_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"empty":           `{"profiles": []}`,
+		"missing name":    `{"profiles": [{"credentials": "c.json"}]}`,
+		"duplicate":       `{"profiles": [{"name": "a", "credentials": "c.json"}, {"name": "a", "credentials": "d.json"}]}`,
+		"unknown default": `{"default": "b", "profiles": [{"name": "a", "credentials": "c.json"}]}`,
+	}
+
+	for name, content := range tests {
+		path := filepath.Join(t.TempDir(), "profiles.json")
+		os.WriteFile(path, []byte(content), 0600)
+		if _, err := loadProfiles(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestFindProfile(t *testing.T) {
+	profiles := []profile{{Name: "personal"}, {Name: "work"}}
+
+	if p, _ := findProfile(profiles, ""); p.Name != "personal" {
+		t.Errorf("expected default profile, got %q", p.Name)
+	}
+	if p, _ := findProfile(profiles, "work"); p.Name != "work" {
+		t.Errorf("expected work profile, got %q", p.Name)
+	}
+	if _, err := findProfile(profiles, "other"); err == nil || !strings.Contains(err.Error(), "personal, work") {
+		t.Errorf("expected unknown account error listing profiles, got %v", err)
+	}
+}
+
+func TestCallTool_AccountSelection(t *testing.T) {
+	personal := &fakeTasks{taskItems: []TaskItem{{ID: "p1", Title: "Personal task", Status: "needsAction"}}}
+	work := &fakeTasks{taskItems: []TaskItem{{ID: "w1", Title: "Work task", Status: "needsAction"}}}
+	s := newMultiAccountServer(personal, work)
+
+	text := getResponseText(t, callTool(s, toolListTasks, nil))
+	if !strings.Contains(text, "Personal task") {
+		t.Errorf("expected default account, got: %s", text)
+	}
+
+	text = getResponseText(t, callTool(s, toolListTasks, map[string]interface{}{"account": "work"}))
+	if !strings.Contains(text, "Work task") {
+		t.Errorf("expected work account, got: %s", text)
+	}
+
+	resp := callTool(s, toolListTasks, map[string]interface{}{"account": "other"})
+	text = getResponseText(t, resp)
+	if !strings.Contains(text, `unknown account "other"`) || !strings.Contains(text, "personal, work") {
+		t.Errorf("expected unknown account error, got: %s", text)
+	}
+}
+
+func TestCallTool_AccountListCachesAreSeparate(t *testing.T) {
+	personal := &fakeTasks{taskLists: []TaskListItem{{ID: "p-list", Title: "Groceries"}}}
+	work := &fakeTasks{taskLists: []TaskListItem{{ID: "w-list", Title: "Groceries"}}}
+	s := newMultiAccountServer(personal, work)
+
+	callTool(s, toolListTasks, map[string]interface{}{"tasklist": "Groceries"})
+	callTool(s, toolListTasks, map[string]interface{}{"tasklist": "Groceries", "account": "work"})
+
+	if personal.lastTasklist != "p-list" || work.lastTasklist != "w-list" {
+		t.Errorf("expected each account to resolve its own list, got %q and %q", personal.lastTasklist, work.lastTasklist)
+	}
+}
+
+func TestCallListAccounts(t *testing.T) {
+	s := newMultiAccountServer(&fakeTasks{}, &fakeTasks{})
+
+	resp := callTool(s, toolListAccounts, nil)
+	text := getResponseText(t, resp)
+	if text != "- personal (default)\n- work\n" {
+		t.Errorf("unexpected text: %q", text)
+	}
+
+	accounts := getStructuredContent(t, resp)["accounts"].([]map[string]interface{})
+	if len(accounts) != 2 || accounts[1]["name"] != "work" || accounts[1]["default"] != false {
+		t.Errorf("unexpected structured content: %v", accounts)
+	}
+}
+
+func TestHandleToolsList_AccountArgument(t *testing.T) {
+	s := newMultiAccountServer(&fakeTasks{}, &fakeTasks{})
+	resp := s.handleRequest(context.Background(), JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "tools/list"})
+	tools := resp.Result.(map[string]interface{})["tools"].([]map[string]interface{})
+
+	for _, tool := range tools {
+		props := tool["inputSchema"].(map[string]interface{})["properties"].(map[string]interface{})
+		prop, ok := props["account"].(map[string]interface{})
+		if tool["name"] == toolListAccounts {
+			if ok {
+				t.Error("list_accounts should not take an account")
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("tool %s: missing account argument", tool["name"])
+			continue
+		}
+		if names := prop["enum"].([]string); len(names) != 2 || names[0] != "personal" {
+			t.Errorf("tool %s: unexpected account enum %v", tool["name"], names)
+		}
+	}
+}
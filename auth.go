@@ -1,25 +1,49 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/tasks/v1"
 )
 
+// emailScope lets --auth-status tell which Google account a token belongs to
+const emailScope = "https://www.googleapis.com/auth/userinfo.email"
+
+// oauthScope returns the Tasks scope to request, read-only or full access
+func oauthScope(readOnly bool) string {
+	if readOnly {
+		return tasks.TasksReadonlyScope
+	}
+	return tasks.TasksScope
+}
+
 // OAuth2 configuration
-func getOAuthConfig(credentialsFile string) (*oauth2.Config, error) {
+func getOAuthConfig(credentialsFile, scope string) (*oauth2.Config, error) {
 	b, err := os.ReadFile(credentialsFile)
 	if err != nil {
 		return nil, fmt.Errorf("unable to read credentials file: %v", err)
 	}
 
-	config, err := google.ConfigFromJSON(b, tasks.TasksScope)
+	config, err := google.ConfigFromJSON(b, scope, emailScope)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse credentials: %v", err)
 	}
@@ -39,78 +63,399 @@ func getTokenFromFile(file string) (*oauth2.Token, error) {
 	return tok, err
 }
 
-// saveToken saves token to file
+// saveToken saves token to file as plaintext JSON
 func saveToken(path string, token *oauth2.Token) error {
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	data, err := json.Marshal(token)
 	if err != nil {
 		return fmt.Errorf("unable to save token: %v", err)
 	}
-	defer f.Close()
-	return json.NewEncoder(f).Encode(token)
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("unable to save token: %v", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data, readable only by the owner. The data
+// is written to a temp file in the same directory and renamed over path while
+// holding the file's lock, so readers never see a partial file and concurrent
+// writers don't interleave.
+func writeFileAtomic(path string, data []byte) error {
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return fmt.Errorf("unable to lock %s: %v", path, err)
+	}
+	defer unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
 
-// getClient returns an HTTP client with OAuth2 token
-func getClient(config *oauth2.Config, tokenFile string) (*http.Client, error) {
-	tok, err := getTokenFromFile(tokenFile)
+// getClient returns an HTTP client with OAuth2 token, along with the token
+// it checked at startup. Every refresh, at startup or later, is written back
+// to store.
+func getClient(config *oauth2.Config, store tokenStore) (*http.Client, *oauth2.Token, error) {
+	tok, err := store.Load()
 	if err != nil {
-		return nil, fmt.Errorf("token not found, run with --auth first: %v", err)
+		return nil, nil, fmt.Errorf("token not found, run with --auth first: %v", err)
 	}
 
-	// Token auto-refresh
-	tokenSource := config.TokenSource(context.Background(), tok)
-	newToken, err := tokenSource.Token()
+	tokenSource := newPersistingTokenSource(config, store, tok)
+	current, err := tokenSource.Token()
 	if err != nil {
-		return nil, fmt.Errorf("failed to refresh token: %v", err)
+		return nil, nil, fmt.Errorf("failed to refresh token: %v", err)
 	}
 
-	// Save refreshed token if it changed
-	if newToken.AccessToken != tok.AccessToken {
-		if err := saveToken(tokenFile, newToken); err != nil {
-			// Non-fatal, just log
-			fmt.Fprintf(os.Stderr, "Warning: failed to save refreshed token: %v\n", err)
+	return oauth2.NewClient(context.Background(), tokenSource), current, nil
+}
+
+// loopbackHost is where the authorization redirect lands; Google allows any
+// port on the loopback address for desktop clients
+const loopbackHost = "127.0.0.1"
+
+// authSession holds the per-attempt secrets of an authorization code flow
+type authSession struct {
+	config   *oauth2.Config
+	state    string
+	verifier string
+}
+
+// pendingAuth is what a manual flow saves between --auth --manual and --token
+type pendingAuth struct {
+	State       string `json:"state"`
+	Verifier    string `json:"verifier"`
+	RedirectURL string `json:"redirect_url"`
+}
+
+// newAuthSession prepares a flow redirecting to redirectURL with a random state and PKCE verifier
+func newAuthSession(config *oauth2.Config, redirectURL string) (*authSession, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("unable to generate state: %v", err)
+	}
+
+	cfg := *config
+	cfg.RedirectURL = redirectURL
+	return &authSession{
+		config:   &cfg,
+		state:    hex.EncodeToString(b),
+		verifier: oauth2.GenerateVerifier(),
+	}, nil
+}
+
+// authURL returns the consent page URL, requesting a refresh token
+func (a *authSession) authURL() string {
+	return a.config.AuthCodeURL(a.state, oauth2.AccessTypeOffline, oauth2.ApprovalForce, oauth2.S256ChallengeOption(a.verifier))
+}
+
+// errStateMismatch reports a redirect that doesn't belong to the flow
+var errStateMismatch = errors.New("state mismatch, possible forged redirect")
+
+// codeFromRedirect extracts the authorization code from a redirect URL or its
+// query string, verifying the state. With bareCode set, a code alone, which
+// can't be checked against the state, is accepted as is.
+func (a *authSession) codeFromRedirect(input string, bareCode bool) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", fmt.Errorf("no authorization code given")
+	}
+	if !strings.Contains(input, "=") {
+		if !bareCode {
+			return "", fmt.Errorf("paste the whole URL the browser was redirected to, not just the code")
 		}
+		return input, nil
 	}
 
-	return config.Client(context.Background(), newToken), nil
+	query := input
+	if i := strings.Index(input, "?"); i >= 0 {
+		query = input[i+1:]
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse redirect URL: %v", err)
+	}
+	return a.codeFromQuery(values)
 }
 
-// runAuthFlow performs OAuth2 authorization flow (manual code entry for headless servers)
-func runAuthFlow(credentialsFile, tokenFile string) error {
-	config, err := getOAuthConfig(credentialsFile)
+func (a *authSession) codeFromQuery(values url.Values) (string, error) {
+	if subtle.ConstantTimeCompare([]byte(values.Get("state")), []byte(a.state)) != 1 {
+		return "", errStateMismatch
+	}
+	if e := values.Get("error"); e != "" {
+		return "", fmt.Errorf("authorization denied: %s", e)
+	}
+	code := values.Get("code")
+	if code == "" {
+		return "", fmt.Errorf("redirect has no authorization code")
+	}
+	return code, nil
+}
+
+// exchange trades an authorization code for a token, proving the PKCE verifier
+func (a *authSession) exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	tok, err := a.config.Exchange(ctx, code, oauth2.VerifierOption(a.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("unable to exchange code for token: %v", err)
+	}
+	return tok, nil
+}
+
+// loopbackAuth runs the authorization code flow with a redirect to a local
+// listener on an ephemeral port. open is given the auth URL to show the user.
+// Callbacks that don't carry the flow's state are refused without ending the
+// wait. For hosts where the browser runs elsewhere, the redirect URL can
+// instead be pasted into paste.
+func loopbackAuth(ctx context.Context, config *oauth2.Config, open func(string), paste io.Reader) (*oauth2.Token, error) {
+	ln, err := net.Listen("tcp", net.JoinHostPort(loopbackHost, "0"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to start callback listener: %v", err)
+	}
+	defer ln.Close()
+
+	redirectURL := fmt.Sprintf("http://%s/callback", ln.Addr().String())
+	session, err := newAuthSession(config, redirectURL)
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 2)
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+		code, err := session.codeFromQuery(r.URL.Query())
+		if errors.Is(err, errStateMismatch) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Authorization complete. You can close this window.")
+		}
+		select {
+		case results <- result{code, err}:
+		default:
+		}
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	if paste != nil {
+		go func() {
+			line, err := bufio.NewReader(paste).ReadString('\n')
+			if err != nil && line == "" {
+				return
+			}
+			code, err := session.codeFromRedirect(line, false)
+			select {
+			case results <- result{code, err}:
+			default:
+			}
+		}()
+	}
+
+	open(session.authURL())
+
+	select {
+	case res := <-results:
+		if res.err != nil {
+			return nil, res.err
+		}
+		return session.exchange(ctx, res.code)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// runAuthFlow authorizes through a loopback redirect and saves the token
+func runAuthFlow(credentialsFile, scope string, store tokenStore) error {
+	config, err := getOAuthConfig(credentialsFile, scope)
 	if err != nil {
 		return err
 	}
 
-	// Use OOB redirect for manual code entry
-	config.RedirectURL = "urn:ietf:wg:oauth:2.0:oob"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
 
-	// Generate auth URL
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline, oauth2.ApprovalForce)
-	fmt.Printf("AUTH_URL:%s\n", authURL)
+	tok, err := loopbackAuth(ctx, config, func(authURL string) {
+		fmt.Printf("AUTH_URL:%s\n", authURL)
+		fmt.Println("Open the URL in a browser and authorize. If the browser runs on another machine, paste the URL it was redirected to here:")
+		openBrowser(authURL)
+	}, os.Stdin)
+	if err != nil {
+		return err
+	}
 
+	if err := store.Save(tok); err != nil {
+		return err
+	}
+
+	fmt.Printf("Token saved to: %s\n", store)
 	return nil
 }
 
-// exchangeCode exchanges authorization code for token
-func exchangeCode(credentialsFile, tokenFile, code string) error {
-	config, err := getOAuthConfig(credentialsFile)
+// runManualAuthFlow prints the auth URL for headless hosts and saves the flow's
+// secrets so that --token can finish it from the pasted redirect URL
+func runManualAuthFlow(credentialsFile, scope, tokenFile string) error {
+	config, err := getOAuthConfig(credentialsFile, scope)
 	if err != nil {
 		return err
 	}
 
-	config.RedirectURL = "urn:ietf:wg:oauth:2.0:oob"
+	session, err := newAuthSession(config, fmt.Sprintf("http://%s/callback", loopbackHost))
+	if err != nil {
+		return err
+	}
 
-	// Exchange code for token
-	tok, err := config.Exchange(context.Background(), code)
+	pending := pendingAuth{State: session.state, Verifier: session.verifier, RedirectURL: session.config.RedirectURL}
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(pendingAuthFile(tokenFile), data, 0600); err != nil {
+		return fmt.Errorf("unable to save pending authorization: %v", err)
+	}
+
+	fmt.Printf("AUTH_URL:%s\n", session.authURL())
+	return nil
+}
+
+// exchangeCode finishes a manual flow from the redirect URL or code the user
+// pasted. tokenFile locates the pending flow; the token goes to store.
+func exchangeCode(credentialsFile, scope, tokenFile string, store tokenStore, code string) error {
+	config, err := getOAuthConfig(credentialsFile, scope)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(pendingAuthFile(tokenFile))
+	if err != nil {
+		return fmt.Errorf("no pending authorization, run with --auth --manual first: %v", err)
+	}
+	var pending pendingAuth
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return fmt.Errorf("unable to read pending authorization: %v", err)
+	}
+
+	cfg := *config
+	cfg.RedirectURL = pending.RedirectURL
+	session := &authSession{config: &cfg, state: pending.State, verifier: pending.Verifier}
+
+	code, err = session.codeFromRedirect(code, true)
+	if err != nil {
+		return err
+	}
+	tok, err := session.exchange(context.Background(), code)
 	if err != nil {
-		return fmt.Errorf("unable to exchange code for token: %v", err)
+		return err
 	}
 
 	// Save token
-	if err := saveToken(tokenFile, tok); err != nil {
+	if err := store.Save(tok); err != nil {
 		return err
 	}
+	os.Remove(pendingAuthFile(tokenFile))
 
-	fmt.Printf("Token saved to: %s\n", tokenFile)
+	fmt.Printf("Token saved to: %s\n", store)
 	return nil
 }
+
+func pendingAuthFile(tokenFile string) string {
+	return tokenFile + ".pending"
+}
+
+// deviceAuth runs the OAuth 2.0 device authorization grant: show is given the
+// user code and verification URL, then the token endpoint is polled until the
+// user approves, denies, or the code expires.
+func deviceAuth(ctx context.Context, config *oauth2.Config, show func(*oauth2.DeviceAuthResponse)) (*oauth2.Token, error) {
+	cfg := *config
+	if cfg.Endpoint.DeviceAuthURL == "" {
+		cfg.Endpoint.DeviceAuthURL = google.Endpoint.DeviceAuthURL
+	}
+
+	da, err := cfg.DeviceAuth(ctx)
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_scope" {
+		// Google allows only a few scopes in the device flow, and the Tasks
+		// scopes are not among them
+		return nil, fmt.Errorf("the device flow doesn't allow the requested scope (%s); authorize with --auth --manual instead", retrieveErr.ErrorDescription)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to start device authorization: %v", err)
+	}
+
+	show(da)
+
+	tok, err := cfg.DeviceAccessToken(ctx, da)
+	if err != nil {
+		return nil, fmt.Errorf("device authorization failed: %v", err)
+	}
+	return tok, nil
+}
+
+// runDeviceAuthFlow authorizes on a host without a browser by having the user
+// enter a code on another device
+func runDeviceAuthFlow(credentialsFile, scope string, store tokenStore) error {
+	config, err := getOAuthConfig(credentialsFile, scope)
+	if err != nil {
+		return err
+	}
+
+	tok, err := deviceAuth(context.Background(), config, func(da *oauth2.DeviceAuthResponse) {
+		verificationURL := da.VerificationURIComplete
+		if verificationURL == "" {
+			verificationURL = da.VerificationURI
+		}
+		fmt.Printf("VERIFICATION_URL:%s\n", verificationURL)
+		fmt.Printf("USER_CODE:%s\n", da.UserCode)
+		fmt.Println("Open the URL on any device, enter the code and approve. Waiting for approval...")
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := store.Save(tok); err != nil {
+		return err
+	}
+
+	fmt.Printf("Token saved to: %s\n", store)
+	return nil
+}
+
+// openBrowser tries to open target in the desktop browser, ignoring failures
+func openBrowser(target string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", target)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	default:
+		cmd = exec.Command("xdg-open", target)
+	}
+	if err := cmd.Start(); err == nil {
+		go cmd.Wait()
+	}
+}
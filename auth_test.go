@@ -1,8 +1,17 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -56,3 +65,348 @@ func TestGetTokenFromFile_NotFound(t *testing.T) {
 		t.Error("expected error for nonexistent file")
 	}
 }
+
+// newTestTokenEndpoint stands in for Google's token endpoint, accepting code
+// "good-code" only when the PKCE verifier matches the challenge sent earlier.
+func newTestTokenEndpoint(t *testing.T, challenge *string) *oauth2.Config {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if r.Form.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != *challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"invalid_grant"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access",
+			"refresh_token": "refresh",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	return &oauth2.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   "https://accounts.example/auth",
+			TokenURL:  srv.URL,
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+func TestGetOAuthConfig_Scope(t *testing.T) {
+	credentialsFile := filepath.Join(t.TempDir(), "credentials.json")
+	os.WriteFile(credentialsFile, []byte(`{"installed":{"client_id":"id","client_secret":"secret","redirect_uris":["http://localhost"]}}`), 0600)
+
+	for readOnly, want := range map[bool]string{
+		false: "https://www.googleapis.com/auth/tasks",
+		true:  "https://www.googleapis.com/auth/tasks.readonly",
+	} {
+		config, err := getOAuthConfig(credentialsFile, oauthScope(readOnly))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Join(config.Scopes, " ") != want+" "+emailScope {
+			t.Errorf("read-only %v: expected scope %s, got %v", readOnly, want, config.Scopes)
+		}
+	}
+}
+
+func TestLoopbackAuth(t *testing.T) {
+	var challenge string
+	config := newTestTokenEndpoint(t, &challenge)
+
+	// Play the browser: approve and follow the redirect to the local listener
+	browser := func(authURL string) {
+		u, _ := url.Parse(authURL)
+		q := u.Query()
+		challenge = q.Get("code_challenge")
+		if q.Get("code_challenge_method") != "S256" || q.Get("access_type") != "offline" {
+			t.Errorf("unexpected auth URL: %s", authURL)
+		}
+		redirect := q.Get("redirect_uri") + "?" + url.Values{"code": {"good-code"}, "state": {q.Get("state")}}.Encode()
+		go func() {
+			resp, err := http.Get(redirect)
+			if err != nil {
+				t.Errorf("callback failed: %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tok, err := loopbackAuth(ctx, config, browser, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tok.AccessToken != "access" || tok.RefreshToken != "refresh" {
+		t.Errorf("unexpected token: %+v", tok)
+	}
+}
+
+func TestLoopbackAuth_IgnoresWrongState(t *testing.T) {
+	var challenge string
+	config := newTestTokenEndpoint(t, &challenge)
+
+	// A stray callback arrives before the real one
+	browser := func(authURL string) {
+		u, _ := url.Parse(authURL)
+		q := u.Query()
+		challenge = q.Get("code_challenge")
+		go func() {
+			for _, query := range []string{"code=bad-code&state=forged", "code=bad-code", "error=access_denied"} {
+				resp, err := http.Get(q.Get("redirect_uri") + "?" + query)
+				if err != nil {
+					t.Errorf("callback failed: %v", err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusBadRequest {
+					t.Errorf("%s: expected 400, got %d", query, resp.StatusCode)
+				}
+			}
+			redirect := q.Get("redirect_uri") + "?" + url.Values{"code": {"good-code"}, "state": {q.Get("state")}}.Encode()
+			if resp, err := http.Get(redirect); err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tok, err := loopbackAuth(ctx, config, browser, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tok.AccessToken != "access" {
+		t.Errorf("unexpected token: %+v", tok)
+	}
+}
+
+func TestLoopbackAuth_PastedRedirect(t *testing.T) {
+	var challenge string
+	config := newTestTokenEndpoint(t, &challenge)
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	// The browser runs elsewhere; the user pastes the URL it landed on
+	browser := func(authURL string) {
+		u, _ := url.Parse(authURL)
+		q := u.Query()
+		challenge = q.Get("code_challenge")
+		pasted := "http://127.0.0.1:1/callback?state=" + q.Get("state") + "&code=good-code\n"
+		go io.WriteString(pw, pasted)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tok, err := loopbackAuth(ctx, config, browser, pr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tok.AccessToken != "access" {
+		t.Errorf("unexpected token: %+v", tok)
+	}
+}
+
+func TestAuthSession_CodeFromRedirect(t *testing.T) {
+	session := &authSession{state: "abc"}
+
+	tests := []struct {
+		input    string
+		bareCode bool
+		code     string
+		wantErr  bool
+	}{
+		{input: "http://127.0.0.1/callback?state=abc&code=xyz", code: "xyz"},
+		{input: "state=abc&code=xyz", code: "xyz"},
+		{input: "  xyz\n", bareCode: true, code: "xyz"},
+		{input: "xyz", wantErr: true},
+		{input: "http://127.0.0.1/callback?state=other&code=xyz", wantErr: true},
+		{input: "http://127.0.0.1/callback?code=xyz", bareCode: true, wantErr: true},
+		{input: "http://127.0.0.1/callback?state=abc&error=access_denied", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		code, err := session.codeFromRedirect(tt.input, tt.bareCode)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error", tt.input)
+			}
+			continue
+		}
+		if err != nil || code != tt.code {
+			t.Errorf("%q: expected %q, got %q (%v)", tt.input, tt.code, code, err)
+		}
+	}
+}
+
+func TestManualAuthFlow(t *testing.T) {
+	var challenge string
+	config := newTestTokenEndpoint(t, &challenge)
+
+	dir := t.TempDir()
+	credentialsFile := filepath.Join(dir, "credentials.json")
+	tokenFile := filepath.Join(dir, "token.json")
+	creds, _ := json.Marshal(map[string]interface{}{
+		"installed": map[string]interface{}{
+			"client_id":     config.ClientID,
+			"client_secret": config.ClientSecret,
+			"auth_uri":      config.Endpoint.AuthURL,
+			"token_uri":     config.Endpoint.TokenURL,
+			"redirect_uris": []string{"http://localhost"},
+		},
+	})
+	os.WriteFile(credentialsFile, creds, 0600)
+
+	stdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	err := runManualAuthFlow(credentialsFile, oauthScope(false), tokenFile)
+	w.Close()
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, _ := io.ReadAll(r)
+
+	authURL := strings.TrimPrefix(strings.TrimSpace(string(out)), "AUTH_URL:")
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("unexpected output: %s", out)
+	}
+	q := u.Query()
+	challenge = q.Get("code_challenge")
+
+	os.Stdout, _ = os.Open(os.DevNull)
+	err = exchangeCode(credentialsFile, oauthScope(false), tokenFile, &fileTokenStore{path: tokenFile}, q.Get("redirect_uri")+"?state="+q.Get("state")+"&code=good-code")
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tok, err := getTokenFromFile(tokenFile)
+	if err != nil || tok.RefreshToken != "refresh" {
+		t.Errorf("expected saved token, got %+v (%v)", tok, err)
+	}
+	if _, err := os.Stat(pendingAuthFile(tokenFile)); !os.IsNotExist(err) {
+		t.Errorf("expected pending authorization to be removed, got %v", err)
+	}
+}
+
+func TestDeviceAuth(t *testing.T) {
+	var polls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/device":
+			if r.Form.Get("client_id") != "client" || r.Form.Get("scope") != "tasks" {
+				t.Errorf("unexpected device request: %v", r.Form)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"device_code":      "device-123",
+				"user_code":        "ABCD-EFGH",
+				"verification_url": "https://example.com/device",
+				"expires_in":       60,
+				"interval":         1,
+			})
+		case "/token":
+			if r.Form.Get("device_code") != "device-123" {
+				t.Errorf("unexpected device code: %q", r.Form.Get("device_code"))
+			}
+			polls++
+			if polls == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, `{"error":"authorization_pending"}`)
+				return
+			}
+			io.WriteString(w, `{"access_token":"access","refresh_token":"refresh","token_type":"Bearer","expires_in":3600}`)
+		}
+	}))
+	defer srv.Close()
+
+	config := &oauth2.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"tasks"},
+		Endpoint: oauth2.Endpoint{
+			DeviceAuthURL: srv.URL + "/device",
+			TokenURL:      srv.URL + "/token",
+			AuthStyle:     oauth2.AuthStyleInParams,
+		},
+	}
+
+	var shown *oauth2.DeviceAuthResponse
+	tok, err := deviceAuth(context.Background(), config, func(da *oauth2.DeviceAuthResponse) { shown = da })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if shown == nil || shown.UserCode != "ABCD-EFGH" || shown.VerificationURI != "https://example.com/device" {
+		t.Errorf("expected user code and verification URL to be shown, got %+v", shown)
+	}
+	if polls != 2 {
+		t.Errorf("expected polling until approval, got %d polls", polls)
+	}
+	if tok.AccessToken != "access" || tok.RefreshToken != "refresh" {
+		t.Errorf("unexpected token: %+v", tok)
+	}
+}
+
+func TestDeviceAuth_InvalidScope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":"invalid_scope","error_description":"Invalid device flow scope: https://www.googleapis.com/auth/tasks"}`)
+	}))
+	defer srv.Close()
+
+	config := &oauth2.Config{
+		ClientID: "client",
+		Scopes:   []string{"https://www.googleapis.com/auth/tasks"},
+		Endpoint: oauth2.Endpoint{DeviceAuthURL: srv.URL + "/device", TokenURL: srv.URL + "/token"},
+	}
+
+	_, err := deviceAuth(context.Background(), config, func(*oauth2.DeviceAuthResponse) {
+		t.Error("expected no user code to be shown")
+	})
+	if err == nil || !strings.Contains(err.Error(), "--auth --manual") {
+		t.Errorf("expected a pointer to --auth --manual, got %v", err)
+	}
+}
+
+func TestDeviceAuth_Denied(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/device" {
+			io.WriteString(w, `{"device_code":"d","user_code":"u","verification_url":"https://example.com/device","expires_in":60,"interval":1}`)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":"access_denied"}`)
+	}))
+	defer srv.Close()
+
+	config := &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{DeviceAuthURL: srv.URL + "/device", TokenURL: srv.URL + "/token"},
+	}
+
+	_, err := deviceAuth(context.Background(), config, func(*oauth2.DeviceAuthResponse) {})
+	if err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("expected access_denied error, got %v", err)
+	}
+}
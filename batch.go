@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// batchConcurrency bounds how many operations of a batch run at once
+	batchConcurrency = 4
+
+	// maxBatchOperations bounds the operations in one batch call
+	maxBatchOperations = 50
+)
+
+// batchTools maps a batch operation to the tool that runs it.
+var batchTools = map[string]string{
+	"create":   toolCreateTask,
+	"update":   toolUpdateTask,
+	"complete": toolCompleteTask,
+	"delete":   toolDeleteTask,
+	"move":     toolMoveTask,
+}
+
+func batchOpNames() []string {
+	names := make([]string, 0, len(batchTools))
+	for op := range batchTools {
+		names = append(names, op)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// batchResult is the outcome of one operation of a batch.
+type batchResult struct {
+	Index  int                    `json:"index"`
+	Op     string                 `json:"op"`
+	Status string                 `json:"status"`
+	Result map[string]interface{} `json:"result,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+
+	text string
+}
+
+const (
+	batchSucceeded  = "succeeded"
+	batchFailed     = "failed"
+	batchSkipped    = "skipped"
+	batchRolledBack = "rolled_back"
+)
+
+// callBatch runs several task operations through the tools that implement
+// them, so each one is validated and checked against the policy as if it were
+// called on its own. Operations on the same task list run one after another
+// in the order given, so created tasks keep that order; different lists are
+// worked on concurrently. In atomic mode a failure skips the operations not
+// yet started and deletes the tasks the batch created; other changes stay.
+func (s *Server) callBatch(ctx context.Context, id interface{}, args json.RawMessage) *JSONRPCResponse {
+	var input struct {
+		Operations []json.RawMessage `json:"operations"`
+		Atomic     bool              `json:"atomic"`
+	}
+
+	if err := json.Unmarshal(args, &input); err != nil {
+		return s.paramError(id, "Invalid arguments", err.Error())
+	}
+
+	if len(input.Operations) == 0 {
+		return s.paramError(id, "operations is required", nil)
+	}
+	if len(input.Operations) > maxBatchOperations {
+		return s.paramError(id, fmt.Sprintf("a batch takes at most %d operations", maxBatchOperations), nil)
+	}
+
+	type operation struct {
+		Op         string `json:"op"`
+		TasklistID string `json:"tasklist_id"`
+		Tasklist   string `json:"tasklist"`
+
+		// listID is the task list the operation was resolved to
+		listID string
+	}
+	ops := make([]operation, len(input.Operations))
+	for i, raw := range input.Operations {
+		if err := json.Unmarshal(raw, &ops[i]); err != nil {
+			return s.paramError(id, fmt.Sprintf("Invalid operation %d", i), err.Error())
+		}
+		if _, ok := batchTools[ops[i].Op]; !ok {
+			return s.paramError(id, fmt.Sprintf("operation %d: op must be one of %s", i, strings.Join(batchOpNames(), ", ")), nil)
+		}
+	}
+
+	results := make([]batchResult, len(ops))
+	var failed atomic.Bool
+	var lists []string
+	queues := make(map[string][]int)
+	for i := range ops {
+		op := &ops[i]
+		results[i] = batchResult{Index: i, Op: op.Op}
+
+		tool := batchTools[op.Op]
+		var err error
+		if !s.policy.allowsTool(tool) {
+			err = fmt.Errorf("%s is disabled by the server's policy", tool)
+		} else if err = s.checkLists(ctx, tool, input.Operations[i]); err == nil {
+			op.listID, err = s.batchList(ctx, op.TasklistID, op.Tasklist)
+		}
+		if err == nil {
+			// Pin the operation to the list it was resolved and checked against
+			input.Operations[i], err = withTasklistID(input.Operations[i], op.listID)
+		}
+		if err != nil {
+			results[i].Status = batchFailed
+			results[i].Error = err.Error()
+			failed.Store(true)
+			continue
+		}
+
+		if _, ok := queues[op.listID]; !ok {
+			lists = append(lists, op.listID)
+		}
+		queues[op.listID] = append(queues[op.listID], i)
+	}
+
+	sem := make(chan struct{}, batchConcurrency)
+	var wg sync.WaitGroup
+	for _, listID := range lists {
+		wg.Add(1)
+		go func(queue []int) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+			}
+
+			for _, i := range queue {
+				r := &results[i]
+				if (input.Atomic && failed.Load()) || ctx.Err() != nil {
+					r.Status = batchSkipped
+					continue
+				}
+
+				r.text, r.Result, r.Error = toolOutcome(s.dispatchTool(ctx, id, batchTools[ops[i].Op], input.Operations[i]))
+				if r.Error != "" {
+					r.Status = batchFailed
+					failed.Store(true)
+				} else {
+					r.Status = batchSucceeded
+				}
+			}
+		}(queues[listID])
+	}
+	wg.Wait()
+
+	// Undo creates newest first; the caller's cancellation must not stop it
+	if input.Atomic && failed.Load() {
+		rollbackCtx := context.WithoutCancel(ctx)
+		for i := len(ops) - 1; i >= 0; i-- {
+			r := &results[i]
+			if r.Op != "create" || r.Status != batchSucceeded {
+				continue
+			}
+			task, _ := r.Result["task"].(TaskItem)
+			if task.ID == "" {
+				r.Error = "rollback failed: created task ID unknown"
+				continue
+			}
+			if err := s.account(ctx).tasks.DeleteTask(rollbackCtx, ops[i].listID, task.ID); err != nil {
+				r.Error = fmt.Sprintf("rollback failed: %v", err)
+				continue
+			}
+			r.Status = batchRolledBack
+		}
+	}
+
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.Status]++
+	}
+
+	text := fmt.Sprintf("Batch finished: %d succeeded, %d failed, %d skipped", counts[batchSucceeded], counts[batchFailed], counts[batchSkipped])
+	if input.Atomic && counts[batchFailed] > 0 {
+		text += fmt.Sprintf(", %d rolled back (only created tasks are rolled back; other changes stay applied)", counts[batchRolledBack])
+	}
+	for _, r := range results {
+		text += fmt.Sprintf("\n\n[%d] %s: %s", r.Index, r.Op, r.Status)
+		if r.Error != "" {
+			text += "\n" + r.Error
+		} else if r.text != "" && r.Status == batchSucceeded {
+			text += "\n" + r.text
+		}
+	}
+
+	resp := s.structuredResponse(id, text, map[string]interface{}{
+		"succeeded":   counts[batchSucceeded],
+		"failed":      counts[batchFailed],
+		"skipped":     counts[batchSkipped],
+		"rolled_back": counts[batchRolledBack],
+		"results":     results,
+	})
+	// Only report the call as failed when none of it took effect
+	if counts[batchFailed] > 0 && counts[batchSucceeded] == 0 {
+		resp.Result.(map[string]interface{})["isError"] = true
+	}
+	return resp
+}
+
+// batchList resolves the task list an operation works on, naming the default
+// list by its ID so that operations on it queue together however they name it.
+func (s *Server) batchList(ctx context.Context, tasklistID, name string) (string, error) {
+	listID, err := s.resolveTasklistExact(ctx, tasklistID, name)
+	if err != nil || listID != defaultTasklistID {
+		return listID, err
+	}
+	l, err := s.defaultTaskList(ctx)
+	if err != nil {
+		return "", err
+	}
+	return l.ID, nil
+}
+
+// withTasklistID returns operation arguments that name their task list by ID.
+func withTasklistID(raw json.RawMessage, listID string) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "tasklist")
+	fields["tasklist_id"], _ = json.Marshal(listID)
+	return json.Marshal(fields)
+}
+
+// toolOutcome splits a tool response into its text and structured content,
+// or the error it reports.
+func toolOutcome(resp *JSONRPCResponse) (string, map[string]interface{}, string) {
+	if resp.Error != nil {
+		if detail, ok := resp.Error.Data.(string); ok && detail != "" {
+			return "", nil, resp.Error.Message + ": " + detail
+		}
+		return "", nil, resp.Error.Message
+	}
+
+	result := resp.Result.(map[string]interface{})
+	var text string
+	if content, ok := result["content"].([]map[string]string); ok && len(content) > 0 {
+		text = content[0]["text"]
+	}
+	if result["isError"] == true {
+		return "", nil, strings.TrimPrefix(text, "Error: ")
+	}
+	structured, _ := result["structuredContent"].(map[string]interface{})
+	return text, structured, ""
+}
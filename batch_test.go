@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/tasks/v1"
+)
+
+// batchTasks is a TasksService safe for the concurrent calls of a batch. It
+// fails operations on the task IDs or titles in fail, and records the most
+// calls it saw in flight at once.
+type batchTasks struct {
+	*fakeTasks
+
+	mu          sync.Mutex
+	fail        map[string]bool
+	created     int
+	deleted     []string
+	inFlight    int
+	maxInFlight int
+	delay       time.Duration
+}
+
+func newBatchTasks(fail ...string) *batchTasks {
+	b := &batchTasks{fakeTasks: &fakeTasks{taskLists: policyLists}, fail: make(map[string]bool)}
+	for _, f := range fail {
+		b.fail[f] = true
+	}
+	return b
+}
+
+// call runs one fake API call, failing it if key is in fail.
+func (b *batchTasks) call(key string) error {
+	b.mu.Lock()
+	b.inFlight++
+	b.maxInFlight = max(b.maxInFlight, b.inFlight)
+	b.mu.Unlock()
+
+	time.Sleep(b.delay)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inFlight--
+	if b.fail[key] {
+		return fmt.Errorf("googleapi: Error 404: %s not found", key)
+	}
+	return nil
+}
+
+func (b *batchTasks) CreateTask(_ context.Context, tasklistID, title, notes, due, parentID string) (*tasks.Task, error) {
+	if err := b.call(title); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.created++
+	return &tasks.Task{Id: fmt.Sprintf("new%d", b.created), Title: title, Status: "needsAction"}, nil
+}
+
+func (b *batchTasks) UpdateTask(_ context.Context, tasklistID, taskID string, updates TaskUpdates) (*tasks.Task, error) {
+	if err := b.call(taskID); err != nil {
+		return nil, err
+	}
+	return &tasks.Task{Id: taskID, Title: "Updated", Status: "needsAction"}, nil
+}
+
+func (b *batchTasks) CompleteTask(_ context.Context, tasklistID, taskID string) (*tasks.Task, error) {
+	if err := b.call(taskID); err != nil {
+		return nil, err
+	}
+	return &tasks.Task{Id: taskID, Title: "Done", Status: "completed"}, nil
+}
+
+func (b *batchTasks) DeleteTask(_ context.Context, tasklistID, taskID string) error {
+	if err := b.call(taskID); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deleted = append(b.deleted, tasklistID+"/"+taskID)
+	return nil
+}
+
+func (b *batchTasks) MoveTask(_ context.Context, tasklistID, taskID, parentID, previousID, destinationTasklistID string) (*tasks.Task, error) {
+	if err := b.call(taskID); err != nil {
+		return nil, err
+	}
+	return &tasks.Task{Id: taskID, Title: "Moved", Status: "needsAction"}, nil
+}
+
+func newBatchServer(b *batchTasks) *Server {
+	return &Server{accounts: []*account{{name: defaultAccountName, tasks: b}}, loc: time.UTC}
+}
+
+// batchStatuses returns the status of each operation of a batch call.
+func batchStatuses(t *testing.T, resp *JSONRPCResponse) []string {
+	t.Helper()
+	if resp.Error != nil {
+		t.Fatalf("unexpected JSON-RPC error: %+v", resp.Error)
+	}
+	structured := resp.Result.(map[string]interface{})["structuredContent"].(map[string]interface{})
+	var statuses []string
+	for _, r := range structured["results"].([]batchResult) {
+		statuses = append(statuses, r.Status)
+	}
+	return statuses
+}
+
+func TestCallBatch_PartialFailure(t *testing.T) {
+	b := newBatchTasks("missing")
+	s := newBatchServer(b)
+
+	resp := callTool(s, toolBatch, map[string]interface{}{
+		"operations": []map[string]interface{}{
+			{"op": "create", "title": "Buy milk", "tasklist": "Inbox"},
+			{"op": "complete", "task_id": "missing"},
+			{"op": "update", "task_id": "t1", "title": "Updated"},
+			{"op": "delete", "task_id": "t2"},
+		},
+	})
+
+	got := batchStatuses(t, resp)
+	want := []string{batchSucceeded, batchFailed, batchSucceeded, batchSucceeded}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	text, isErr := toolResult(t, resp)
+	if isErr {
+		t.Error("expected a partly applied batch not to be an error")
+	}
+	for _, want := range []string{"1 failed", "[0] create: succeeded", "Task created successfully!", "[1] complete: failed\ngoogleapi: Error 404: missing not found"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in:\n%s", want, text)
+		}
+	}
+	if !slices.Equal(b.deleted, []string{"inbox/t2"}) {
+		t.Errorf("expected only the requested delete, got %v", b.deleted)
+	}
+}
+
+func TestCallBatch_BoundedConcurrency(t *testing.T) {
+	b := newBatchTasks()
+	b.delay = 10 * time.Millisecond
+	s := newBatchServer(b)
+
+	// Only operations on different lists run at once
+	var ops []map[string]interface{}
+	for i := 0; i < 3*batchConcurrency; i++ {
+		ops = append(ops, map[string]interface{}{"op": "complete", "task_id": fmt.Sprintf("t%d", i), "tasklist_id": fmt.Sprintf("list%d", i)})
+	}
+	resp := callTool(s, toolBatch, map[string]interface{}{"operations": ops})
+
+	for i, status := range batchStatuses(t, resp) {
+		if status != batchSucceeded {
+			t.Errorf("operation %d: expected success, got %s", i, status)
+		}
+	}
+	if b.maxInFlight > batchConcurrency || b.maxInFlight < 2 {
+		t.Errorf("expected between 2 and %d calls at once, got %d", batchConcurrency, b.maxInFlight)
+	}
+}
+
+func TestCallBatch_SameListInOrder(t *testing.T) {
+	b := newBatchTasks()
+	b.delay = time.Millisecond
+	s := newBatchServer(b)
+
+	var ops []map[string]interface{}
+	for i := 0; i < 10; i++ {
+		// The default list named three ways still forms one queue
+		ops = append(ops, map[string]interface{}{"op": "create", "title": fmt.Sprintf("Step %d", i), "tasklist": []string{"Inbox", "", "inbox"}[i%3]})
+		ops = append(ops, map[string]interface{}{"op": "complete", "task_id": fmt.Sprintf("t%d", i), "tasklist_id": "agent1"})
+	}
+	resp := callTool(s, toolBatch, map[string]interface{}{"operations": ops})
+
+	results := resp.Result.(map[string]interface{})["structuredContent"].(map[string]interface{})["results"].([]batchResult)
+	for i := 0; i < 10; i++ {
+		task := results[2*i].Result["task"].(TaskItem)
+		if task.ID != fmt.Sprintf("new%d", i+1) || task.Title != fmt.Sprintf("Step %d", i) {
+			t.Errorf("expected Step %d to be created in turn, got %+v", i, task)
+		}
+	}
+	if b.maxInFlight != 2 {
+		t.Errorf("expected the two lists to be worked on at once, got %d calls at most", b.maxInFlight)
+	}
+}
+
+func TestCallBatch_AtomicRollsBackCreates(t *testing.T) {
+	b := newBatchTasks("Broken")
+	b.delay = 10 * time.Millisecond
+	s := newBatchServer(b)
+
+	var ops []map[string]interface{}
+	ops = append(ops,
+		map[string]interface{}{"op": "create", "title": "First", "tasklist": "Inbox"},
+		map[string]interface{}{"op": "create", "title": "Broken"},
+	)
+	for i := 0; i < 2*batchConcurrency; i++ {
+		ops = append(ops, map[string]interface{}{"op": "complete", "task_id": fmt.Sprintf("t%d", i)})
+	}
+	resp := callTool(s, toolBatch, map[string]interface{}{"operations": ops, "atomic": true})
+
+	got := batchStatuses(t, resp)
+	if got[0] != batchRolledBack || got[1] != batchFailed {
+		t.Errorf("expected the create rolled back and the failure reported, got %v", got)
+	}
+	// The rest queue behind the failure on the default list, Inbox
+	for i, status := range got[2:] {
+		if status != batchSkipped {
+			t.Errorf("expected operation %d to be skipped, got %v", i+2, got)
+		}
+	}
+	if !slices.Equal(b.deleted, []string{"inbox/new1"}) {
+		t.Errorf("expected the created task to be deleted, got %v", b.deleted)
+	}
+
+	text, _ := toolResult(t, resp)
+	if !strings.Contains(text, "1 rolled back (only created tasks are rolled back") {
+		t.Errorf("expected rollback summary, got:\n%s", text)
+	}
+}
+
+func TestCallBatch_AtomicRollbackFails(t *testing.T) {
+	b := newBatchTasks("Broken", "new1")
+	s := newBatchServer(b)
+
+	resp := callTool(s, toolBatch, map[string]interface{}{
+		"operations": []map[string]interface{}{
+			{"op": "create", "title": "First"},
+			{"op": "create", "title": "Broken"},
+		},
+		"atomic": true,
+	})
+
+	results := resp.Result.(map[string]interface{})["structuredContent"].(map[string]interface{})["results"].([]batchResult)
+	if results[0].Status != batchSucceeded || !strings.HasPrefix(results[0].Error, "rollback failed: ") {
+		t.Errorf("expected the create to stay with the rollback error, got %+v", results[0])
+	}
+}
+
+func TestCallBatch_PolicyChecksEachOperation(t *testing.T) {
+	b := newBatchTasks()
+	s := newBatchServer(b)
+	s.policy = &policy{
+		Deny:  []string{toolDeleteTask},
+		Tools: map[string]toolPolicy{toolCompleteTask: {Lists: []string{"Agent *"}}},
+	}
+
+	resp := callTool(s, toolBatch, map[string]interface{}{
+		"operations": []map[string]interface{}{
+			{"op": "delete", "task_id": "t1"},
+			{"op": "complete", "task_id": "t2", "tasklist": "Private"},
+			{"op": "complete", "task_id": "t3", "tasklist": "Agent plans"},
+		},
+	})
+
+	got := batchStatuses(t, resp)
+	if !slices.Equal(got, []string{batchFailed, batchFailed, batchSucceeded}) {
+		t.Errorf("unexpected statuses %v", got)
+	}
+	text, _ := toolResult(t, resp)
+	if !strings.Contains(text, "delete_task is disabled by the server's policy") || !strings.Contains(text, "complete_task may not touch task list") {
+		t.Errorf("expected policy errors, got:\n%s", text)
+	}
+	if len(b.deleted) != 0 {
+		t.Errorf("expected no delete, got %v", b.deleted)
+	}
+
+	// In atomic mode a denied operation stops the whole batch before it starts
+	resp = callTool(s, toolBatch, map[string]interface{}{
+		"operations": []map[string]interface{}{
+			{"op": "complete", "task_id": "t3", "tasklist": "Agent plans"},
+			{"op": "delete", "task_id": "t1"},
+		},
+		"atomic": true,
+	})
+	if got := batchStatuses(t, resp); !slices.Equal(got, []string{batchSkipped, batchFailed}) {
+		t.Errorf("unexpected atomic statuses %v", got)
+	}
+	if _, isErr := toolResult(t, resp); !isErr {
+		t.Error("expected a batch that changed nothing to be an error")
+	}
+}
+
+func TestCallBatch_InvalidArguments(t *testing.T) {
+	s := newBatchServer(newBatchTasks())
+
+	tooMany := make([]map[string]interface{}, maxBatchOperations+1)
+	for i := range tooMany {
+		tooMany[i] = map[string]interface{}{"op": "delete", "task_id": "t1"}
+	}
+
+	for name, args := range map[string]map[string]interface{}{
+		"no operations": {},
+		"empty":         {"operations": []interface{}{}},
+		"unknown op":    {"operations": []map[string]interface{}{{"op": "rename", "task_id": "t1"}}},
+		"too many":      {"operations": tooMany},
+	} {
+		resp := callTool(s, toolBatch, args)
+		if resp.Error == nil || resp.Error.Code != -32602 {
+			t.Errorf("%s: expected invalid params error, got %+v", name, resp)
+		}
+	}
+}
+
+func TestCallBatch_OperationParamError(t *testing.T) {
+	s := newBatchServer(newBatchTasks())
+
+	resp := callTool(s, toolBatch, map[string]interface{}{
+		"operations": []map[string]interface{}{{"op": "create"}},
+	})
+	text, isErr := toolResult(t, resp)
+	if !isErr || !strings.Contains(text, "[0] create: failed\ntitle is required") {
+		t.Errorf("expected the operation's parameter error, got:\n%s", text)
+	}
+}
+
+func TestCallBatch_Cancelled(t *testing.T) {
+	s := newBatchServer(newBatchTasks())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	resp := s.callBatch(ctx, float64(1), []byte(`{"operations": [{"op": "delete", "task_id": "t1"}]}`))
+	if got := batchStatuses(t, resp); !slices.Equal(got, []string{batchSkipped}) {
+		t.Errorf("expected nothing to run after cancellation, got %v", got)
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	sessionHeader = "Mcp-Session-Id"
+
+	// maxHTTPBody matches the stdio scanner's line limit
+	maxHTTPBody = 1024 * 1024
+
+	// sessionQueueSize bounds server messages buffered for an SSE stream
+	sessionQueueSize = 64
+
+	// sessionIdleTimeout ends sessions that neither sent a request nor held
+	// an SSE stream open for that long, checked every sessionSweepInterval
+	sessionIdleTimeout   = 30 * time.Minute
+	sessionSweepInterval = time.Minute
+
+	// maxSessions bounds live sessions; a new one ends the least recently used
+	maxSessions = 100
+)
+
+// httpTransport serves MCP over the Streamable HTTP transport: clients POST
+// JSON-RPC messages and may hold a GET open as an SSE stream for messages the
+// server sends on its own.
+type httpTransport struct {
+	server *Server
+	config httpConfig
+
+	mu       sync.Mutex
+	sessions map[string]*httpSession
+}
+
+// httpConfig restricts who may use the HTTP transport.
+type httpConfig struct {
+	// token, when set, must be sent as a bearer token with every request
+	token string
+
+	// origins lists the browser origins allowed besides loopback ones,
+	// e.g. https://app.example
+	origins []string
+
+	// loopback requires the Host header to name the loopback address the
+	// server is bound to, so pages on rebound domains can't reach it
+	loopback bool
+}
+
+// httpSession is one client's MCP session, created by initialize.
+type httpSession struct {
+	id     string
+	events chan []byte
+	done   chan struct{}
+	once   sync.Once
+
+	// lastSeen is guarded by the transport's mu
+	lastSeen time.Time
+
+	// streams counts the open SSE streams; dropping is set while messages
+	// are dropped for a full queue, so that is only logged once
+	streams  atomic.Int32
+	dropping atomic.Bool
+}
+
+// newHTTPTransport returns an http.Handler serving MCP requests through s.
+func newHTTPTransport(s *Server) *httpTransport {
+	return &httpTransport{
+		server:   s,
+		sessions: make(map[string]*httpSession),
+	}
+}
+
+// serveHTTP listens on addr and serves MCP over HTTP until the listener fails.
+func (s *Server) serveHTTP(addr string, config httpConfig) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	config.loopback = isLoopbackHost(host)
+	if !config.loopback && config.token == "" {
+		log.Printf("Warning: serving MCP on %s without MCP_HTTP_TOKEN; anyone who can reach it can use the Google account", addr)
+	}
+
+	transport := newHTTPTransport(s)
+	transport.config = config
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", transport)
+	go s.watchResources(context.Background())
+	go transport.sweepSessions(context.Background())
+	log.Printf("Serving MCP over HTTP at http://%s/mcp", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+func (t *httpTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if t.config.loopback && !isLoopbackHost(hostname(r.Host)) {
+		http.Error(w, "Forbidden host", http.StatusForbidden)
+		return
+	}
+	if !t.allowedOrigin(r) {
+		http.Error(w, "Forbidden origin", http.StatusForbidden)
+		return
+	}
+	if !t.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		t.handlePost(w, r)
+	case http.MethodGet:
+		t.handleGet(w, r)
+	case http.MethodDelete:
+		t.handleDelete(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (t *httpTransport) handlePost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxHTTPBody+1))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxHTTPBody {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req JSONRPCRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, &JSONRPCResponse{
+			JSONRPC: "2.0",
+			Error:   &RPCError{Code: -32700, Message: "Parse error", Data: err.Error()},
+		})
+		return
+	}
+
+	var session *httpSession
+	if req.Method == "initialize" {
+		session = t.newSession()
+		w.Header().Set(sessionHeader, session.id)
+	} else {
+		var status int
+		if session, status = t.session(r); status != http.StatusOK {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+	}
+	ctx := withNotifier(r.Context(), session)
+
+	// Notifications carry no ID and get no reply; neither do the client's
+	// responses, which carry an ID but no method
+	if req.ID == nil || req.Method == "" {
+		if req.Method != "" {
+			t.server.handleRequest(ctx, req)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	var resp *JSONRPCResponse
+	if apiMethods[req.Method] {
+		reqCtx, done := t.server.trackRequest(ctx, req.ID)
+		resp = t.server.runCall(reqCtx, req)
+		done()
+	} else {
+		resp = t.server.handleRequest(ctx, req)
+	}
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (t *httpTransport) handleGet(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		http.Error(w, "Accept must include text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+
+	session, status := t.session(r)
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// An open stream keeps the session alive
+	session.streams.Add(1)
+	defer func() {
+		t.mu.Lock()
+		session.streams.Add(-1)
+		session.lastSeen = time.Now()
+		t.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case msg := <-session.events:
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg)
+			flusher.Flush()
+		case <-session.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (t *httpTransport) handleDelete(w http.ResponseWriter, r *http.Request) {
+	session, status := t.session(r)
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	t.mu.Lock()
+	delete(t.sessions, session.id)
+	t.mu.Unlock()
+	t.endSession(session)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// newSession registers a session with a random ID, ending the least recently
+// used one if there are already maxSessions.
+func (t *httpTransport) newSession() *httpSession {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	session := &httpSession{
+		id:       hex.EncodeToString(b),
+		events:   make(chan []byte, sessionQueueSize),
+		done:     make(chan struct{}),
+		lastSeen: time.Now(),
+	}
+
+	var evicted *httpSession
+	t.mu.Lock()
+	if len(t.sessions) >= maxSessions {
+		for _, s := range t.sessions {
+			if evicted == nil || s.lastSeen.Before(evicted.lastSeen) {
+				evicted = s
+			}
+		}
+		delete(t.sessions, evicted.id)
+	}
+	t.sessions[session.id] = session
+	t.mu.Unlock()
+
+	if evicted != nil {
+		log.Printf("Ending session %s: too many sessions", evicted.id)
+		t.endSession(evicted)
+	}
+	return session
+}
+
+// sweepSessions ends idle sessions every sessionSweepInterval until ctx is done.
+func (t *httpTransport) sweepSessions(ctx context.Context) {
+	ticker := time.NewTicker(sessionSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.expireSessions(now)
+		}
+	}
+}
+
+// expireSessions ends the sessions idle for longer than sessionIdleTimeout.
+// Clients that come back get a 404 and start a new session.
+func (t *httpTransport) expireSessions(now time.Time) {
+	var expired []*httpSession
+	t.mu.Lock()
+	for id, s := range t.sessions {
+		if s.streams.Load() == 0 && now.Sub(s.lastSeen) > sessionIdleTimeout {
+			delete(t.sessions, id)
+			expired = append(expired, s)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, s := range expired {
+		t.endSession(s)
+	}
+}
+
+// endSession releases a session that was removed from the transport.
+func (t *httpTransport) endSession(session *httpSession) {
+	session.close()
+	t.server.unsubscribeAll(session)
+}
+
+// session looks up the request's session, returning 400 when the header is
+// missing and 404 when the session is unknown or was terminated.
+func (t *httpTransport) session(r *http.Request) (*httpSession, int) {
+	id := r.Header.Get(sessionHeader)
+	if id == "" {
+		return nil, http.StatusBadRequest
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	session, ok := t.sessions[id]
+	if !ok {
+		return nil, http.StatusNotFound
+	}
+	session.lastSeen = time.Now()
+	return session, http.StatusOK
+}
+
+// notify queues a server message for the session's SSE stream. Messages are
+// dropped while no stream is open, and when the client isn't keeping up.
+func (s *httpSession) notify(msg interface{}) {
+	if s.streams.Load() == 0 {
+		return
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	select {
+	case <-s.done:
+	case s.events <- data:
+		s.dropping.Store(false)
+	default:
+		if !s.dropping.Swap(true) {
+			log.Printf("Dropping messages for session %s: queue full", s.id)
+		}
+	}
+}
+
+func (s *httpSession) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// allowedOrigin rejects browser requests from sites other than loopback ones
+// and the configured origins. Requests without an Origin are allowed.
+func (t *httpTransport) allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if isLoopbackHost(u.Hostname()) {
+		return true
+	}
+	for _, allowed := range t.config.origins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorized checks the bearer token, if one is configured.
+func (t *httpTransport) authorized(r *http.Request) bool {
+	if t.config.token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(t.config.token)) == 1
+}
+
+// hostname strips the port from a host[:port] Host header.
+func hostname(hostport string) string {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return hostport
+	}
+	return host
+}
+
+// isLoopbackHost reports whether host names the loopback address.
+func isLoopbackHost(host string) bool {
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	return strings.EqualFold(host, "localhost") || net.ParseIP(host).IsLoopback()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
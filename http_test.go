@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestHTTPServer(t *testing.T) (*httpTransport, *httptest.Server) {
+	t.Helper()
+	transport := newHTTPTransport(newTestServer(&fakeTasks{}))
+	srv := httptest.NewServer(transport)
+	t.Cleanup(srv.Close)
+	return transport, srv
+}
+
+func postJSON(t *testing.T, url, sessionID, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if sessionID != "" {
+		req.Header.Set(sessionHeader, sessionID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func initializeSession(t *testing.T, url string) string {
+	t.Helper()
+	resp := postJSON(t, url, "", `{"jsonrpc":"2.0","id":1,"method":"initialize"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 from initialize, got %d", resp.StatusCode)
+	}
+	sessionID := resp.Header.Get(sessionHeader)
+	if sessionID == "" {
+		t.Fatal("expected session ID header from initialize")
+	}
+	return sessionID
+}
+
+func TestHTTP_InitializeAndToolsList(t *testing.T) {
+	_, srv := newTestHTTPServer(t)
+	sessionID := initializeSession(t, srv.URL)
+
+	resp := postJSON(t, srv.URL, sessionID, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected application/json, got %q", ct)
+	}
+
+	var body struct {
+		ID     float64 `json:"id"`
+		Result struct {
+			Tools []map[string]interface{} `json:"tools"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if body.ID != 2 || len(body.Result.Tools) == 0 {
+		t.Errorf("expected tools list for request 2, got %+v", body)
+	}
+}
+
+func TestHTTP_SessionRequired(t *testing.T) {
+	_, srv := newTestHTTPServer(t)
+
+	resp := postJSON(t, srv.URL, "", `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 without session, got %d", resp.StatusCode)
+	}
+
+	resp = postJSON(t, srv.URL, "unknown", `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown session, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTP_NotificationAccepted(t *testing.T) {
+	_, srv := newTestHTTPServer(t)
+	sessionID := initializeSession(t, srv.URL)
+
+	resp := postJSON(t, srv.URL, sessionID, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("expected 202 for notification, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTP_ParseError(t *testing.T) {
+	_, srv := newTestHTTPServer(t)
+
+	resp := postJSON(t, srv.URL, "", `{not json`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", resp.StatusCode)
+	}
+	var body JSONRPCResponse
+	json.NewDecoder(resp.Body).Decode(&body)
+	if body.Error == nil || body.Error.Code != -32700 {
+		t.Errorf("expected parse error, got %+v", body)
+	}
+}
+
+func TestHTTP_DeleteTerminatesSession(t *testing.T) {
+	_, srv := newTestHTTPServer(t)
+	sessionID := initializeSession(t, srv.URL)
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL, nil)
+	req.Header.Set(sessionHeader, sessionID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 from DELETE, got %d", resp.StatusCode)
+	}
+
+	resp = postJSON(t, srv.URL, sessionID, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 after session termination, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTP_ForeignOriginRejected(t *testing.T) {
+	_, srv := newTestHTTPServer(t)
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize"}`))
+	req.Header.Set("Origin", "https://evil.example")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for foreign origin, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTP_RebindingRejected(t *testing.T) {
+	for _, loopback := range []bool{true, false} {
+		transport, srv := newTestHTTPServer(t)
+		transport.config.loopback = loopback
+
+		// A page on a rebound domain sends its own name as Origin and Host
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize"}`))
+		req.Host = "evil.example:8080"
+		req.Header.Set("Origin", "http://evil.example:8080")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("loopback %v: expected 403 for a matching foreign Origin and Host, got %d", loopback, resp.StatusCode)
+		}
+	}
+}
+
+func TestHTTP_AllowedOrigin(t *testing.T) {
+	transport, srv := newTestHTTPServer(t)
+	transport.config.origins = []string{"https://app.example"}
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize"}`))
+	req.Header.Set("Origin", "https://app.example")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 for a configured origin, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTP_BearerToken(t *testing.T) {
+	transport, srv := newTestHTTPServer(t)
+	transport.config.token = "secret"
+
+	for _, tt := range []struct {
+		method string
+		auth   string
+		want   int
+	}{
+		{http.MethodPost, "", http.StatusUnauthorized},
+		{http.MethodPost, "Bearer wrong", http.StatusUnauthorized},
+		{http.MethodGet, "", http.StatusUnauthorized},
+		{http.MethodDelete, "", http.StatusUnauthorized},
+		{http.MethodPost, "Bearer secret", http.StatusOK},
+	} {
+		req, _ := http.NewRequest(tt.method, srv.URL, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize"}`))
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s with %q: expected %d, got %d", tt.method, tt.auth, tt.want, resp.StatusCode)
+		}
+	}
+}
+
+func TestHTTP_SSEStream(t *testing.T) {
+	transport, srv := newTestHTTPServer(t)
+	sessionID := initializeSession(t, srv.URL)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(sessionHeader, sessionID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %q", ct)
+	}
+
+	transport.mu.Lock()
+	session := transport.sessions[sessionID]
+	transport.mu.Unlock()
+	session.notify(map[string]string{"jsonrpc": "2.0", "method": "notifications/test"})
+
+	lines := make(chan string, 16)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("stream closed before message arrived")
+			}
+			if strings.HasPrefix(line, "data: ") {
+				if !strings.Contains(line, "notifications/test") {
+					t.Errorf("unexpected event data: %s", line)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for SSE message")
+		}
+	}
+}
+
+func TestHTTP_ToolCallCancelled(t *testing.T) {
+	blocking := &blockingTasks{
+		fakeTasks: &fakeTasks{},
+		started:   make(chan struct{}),
+		cancelled: make(chan struct{}),
+	}
+	srv := httptest.NewServer(newHTTPTransport(&Server{accounts: []*account{{name: defaultAccountName, tasks: blocking}}, loc: time.UTC}))
+	t.Cleanup(srv.Close)
+	sessionID := initializeSession(t, srv.URL)
+
+	answered := make(chan int, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"list_task_lists"}}`))
+		req.Header.Set(sessionHeader, sessionID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			answered <- 0
+			return
+		}
+		resp.Body.Close()
+		answered <- resp.StatusCode
+	}()
+	<-blocking.started
+
+	resp := postJSON(t, srv.URL, sessionID, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":2}}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202 for the notification, got %d", resp.StatusCode)
+	}
+	select {
+	case <-blocking.cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the tool call to be cancelled")
+	}
+	if status := <-answered; status != http.StatusAccepted {
+		t.Errorf("expected the cancelled call to get no response, got status %d", status)
+	}
+}
+
+func TestHTTP_ToolCallsShareLimit(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+	s.callsOnce.Do(func() { s.calls = make(chan struct{}, maxConcurrentCalls) })
+	for i := 0; i < maxConcurrentCalls; i++ {
+		s.calls <- struct{}{}
+	}
+	srv := httptest.NewServer(newHTTPTransport(s))
+	t.Cleanup(srv.Close)
+	sessionID := initializeSession(t, srv.URL)
+
+	answered := make(chan struct{})
+	go func() {
+		defer close(answered)
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"list_task_lists"}}`))
+		req.Header.Set(sessionHeader, sessionID)
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	select {
+	case <-answered:
+		t.Fatal("expected the call to wait for a free slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	<-s.calls
+	select {
+	case <-answered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the call to run once a slot was free")
+	}
+}
+
+func TestHTTP_ClientResponseAccepted(t *testing.T) {
+	_, srv := newTestHTTPServer(t)
+	sessionID := initializeSession(t, srv.URL)
+
+	resp := postJSON(t, srv.URL, sessionID, `{"jsonrpc":"2.0","id":"srv-1","result":{}}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("expected 202 for a client response, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTP_IdleSessionsExpire(t *testing.T) {
+	transport, srv := newTestHTTPServer(t)
+	idle := initializeSession(t, srv.URL)
+	streaming := initializeSession(t, srv.URL)
+	active := initializeSession(t, srv.URL)
+
+	long := time.Now().Add(-2 * sessionIdleTimeout)
+	transport.mu.Lock()
+	transport.sessions[idle].lastSeen = long
+	transport.sessions[streaming].lastSeen = long
+	transport.sessions[streaming].streams.Store(1)
+	transport.mu.Unlock()
+
+	transport.expireSessions(time.Now())
+
+	for id, want := range map[string]int{idle: http.StatusNotFound, streaming: http.StatusOK, active: http.StatusOK} {
+		resp := postJSON(t, srv.URL, id, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+		if resp.StatusCode != want {
+			t.Errorf("session %s: expected %d, got %d", id, want, resp.StatusCode)
+		}
+	}
+}
+
+func TestHTTP_SessionCap(t *testing.T) {
+	transport, srv := newTestHTTPServer(t)
+	oldest := initializeSession(t, srv.URL)
+	transport.mu.Lock()
+	transport.sessions[oldest].lastSeen = time.Now().Add(-time.Minute)
+	transport.mu.Unlock()
+
+	for i := 1; i < maxSessions; i++ {
+		transport.newSession()
+	}
+	kept := initializeSession(t, srv.URL)
+
+	transport.mu.Lock()
+	count := len(transport.sessions)
+	transport.mu.Unlock()
+	if count != maxSessions {
+		t.Errorf("expected %d sessions, got %d", maxSessions, count)
+	}
+	if resp := postJSON(t, srv.URL, oldest, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the least recently used session to end, got %d", resp.StatusCode)
+	}
+	if resp := postJSON(t, srv.URL, kept, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the new session to work, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTP_ExpiredSessionUnsubscribed(t *testing.T) {
+	transport, srv := newTestHTTPServer(t)
+	sessionID := initializeSession(t, srv.URL)
+
+	resp := postJSON(t, srv.URL, sessionID, `{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"gtasks://lists/list1"}}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 from subscribe, got %d", resp.StatusCode)
+	}
+
+	transport.mu.Lock()
+	transport.sessions[sessionID].lastSeen = time.Now().Add(-2 * sessionIdleTimeout)
+	transport.mu.Unlock()
+	transport.expireSessions(time.Now())
+
+	transport.server.subsMu.Lock()
+	defer transport.server.subsMu.Unlock()
+	if len(transport.server.subs) != 0 {
+		t.Errorf("expected the expired session's subscriptions to be dropped, got %v", transport.server.subs)
+	}
+}
+
+func TestHTTPSession_NotifyWithoutStream(t *testing.T) {
+	session := &httpSession{events: make(chan []byte, 1), done: make(chan struct{})}
+
+	session.notify(map[string]string{"method": "notifications/resources/updated"})
+	if len(session.events) != 0 {
+		t.Error("expected messages to be dropped while no stream is open")
+	}
+
+	session.streams.Store(1)
+	session.notify(map[string]string{"method": "notifications/resources/updated"})
+	session.notify(map[string]string{"method": "notifications/resources/updated"})
+	if len(session.events) != 1 || !session.dropping.Load() {
+		t.Errorf("expected one queued message and the overflow dropped, got %d", len(session.events))
+	}
+}
@@ -4,10 +4,15 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/api/tasks/v1"
@@ -17,16 +22,57 @@ const (
 	serverName    = "google-tasks"
 	serverVersion = "1.1.0"
 
-	toolListTaskLists = "list_task_lists"
-	toolListTasks     = "list_tasks"
-	toolCreateTask    = "create_task"
-	toolUpdateTask    = "update_task"
-	toolCompleteTask  = "complete_task"
-	toolDeleteTask    = "delete_task"
+	toolListTaskLists  = "list_task_lists"
+	toolCreateTaskList = "create_task_list"
+	toolUpdateTaskList = "update_task_list"
+	toolDeleteTaskList = "delete_task_list"
+	toolListTasks      = "list_tasks"
+	toolCreateTask     = "create_task"
+	toolUpdateTask     = "update_task"
+	toolCompleteTask   = "complete_task"
+	toolReopenTask     = "reopen_task"
+	toolDeleteTask     = "delete_task"
+	toolMoveTask       = "move_task"
+	toolClearCompleted = "clear_completed"
+	toolSearchTasks    = "search_tasks"
+	toolListAccounts   = "list_accounts"
+	toolBatch          = "batch"
 
 	defaultTasklistID = "@default"
+
+	// maxConcurrentCalls bounds how many apiMethods requests run at once
+	maxConcurrentCalls = 8
 )
 
+// mutatingTools change data in Google Tasks; read-only mode hides and rejects them.
+var mutatingTools = map[string]bool{
+	toolCreateTaskList: true,
+	toolUpdateTaskList: true,
+	toolDeleteTaskList: true,
+	toolCreateTask:     true,
+	toolUpdateTask:     true,
+	toolCompleteTask:   true,
+	toolReopenTask:     true,
+	toolDeleteTask:     true,
+	toolMoveTask:       true,
+	toolClearCompleted: true,
+	toolBatch:          true,
+}
+
+// apiMethods are the requests that call the Google API. They run concurrently,
+// at most maxConcurrentCalls at a time, and can be cancelled.
+var apiMethods = map[string]bool{
+	"tools/call":          true,
+	"resources/list":      true,
+	"resources/read":      true,
+	"resources/subscribe": true,
+	"prompts/get":         true,
+}
+
+// supportedProtocolVersions lists MCP revisions this server speaks, newest first.
+// Structured tool output (structuredContent, outputSchema) arrived in 2025-06-18.
+var supportedProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
 type JSONRPCRequest struct {
 	JSONRPC string          `json:"jsonrpc"`
 	ID      interface{}     `json:"id,omitempty"`
@@ -49,55 +95,137 @@ type RPCError struct {
 
 type TasksService interface {
 	ListTaskLists(ctx context.Context) ([]TaskListItem, error)
+	GetTaskList(ctx context.Context, tasklistID string) (*tasks.TaskList, error)
+	CreateTaskList(ctx context.Context, title string) (*tasks.TaskList, error)
+	UpdateTaskList(ctx context.Context, tasklistID, title string) (*tasks.TaskList, error)
+	DeleteTaskList(ctx context.Context, tasklistID string) error
 	ListTasks(ctx context.Context, tasklistID string, showCompleted bool) ([]TaskItem, error)
-	CreateTask(ctx context.Context, tasklistID, title, notes, due string) (*tasks.Task, error)
+	ListTasksPage(ctx context.Context, tasklistID string, showCompleted bool, pageToken string, limit int) (*TaskPage, error)
+	FilterTasks(ctx context.Context, tasklistID string, filter TaskFilter) ([]TaskItem, error)
+	HasTasks(ctx context.Context, tasklistID string) (bool, error)
+	CreateTask(ctx context.Context, tasklistID, title, notes, due, parentID string) (*tasks.Task, error)
 	UpdateTask(ctx context.Context, tasklistID, taskID string, updates TaskUpdates) (*tasks.Task, error)
 	CompleteTask(ctx context.Context, tasklistID, taskID string) (*tasks.Task, error)
 	DeleteTask(ctx context.Context, tasklistID, taskID string) error
+	MoveTask(ctx context.Context, tasklistID, taskID, parentID, previousID, destinationTasklistID string) (*tasks.Task, error)
+	ClearCompleted(ctx context.Context, tasklistID string) error
+	GetTask(ctx context.Context, tasklistID, taskID string) (*tasks.Task, error)
 }
 
 type Server struct {
-	tasks TasksService
-	loc   *time.Location
+	// accounts the server acts for; the first is the default
+	accounts []*account
+	loc      *time.Location
+
+	// readOnly hides and rejects mutatingTools
+	readOnly bool
+
+	// policy restricts tools and the task lists they touch; nil allows everything
+	policy *policy
+
+	// out receives stdio responses; outMu keeps concurrent writes whole
+	outMu sync.Mutex
+	out   io.Writer
+
+	// calls bounds the apiMethods requests running at once, across transports
+	callsOnce sync.Once
+	calls     chan struct{}
+
+	// inflight holds the running apiMethods requests, so they can be cancelled
+	inflightMu sync.Mutex
+	inflight   map[inflightKey]*inflightCall
+
+	// subs holds resource subscriptions keyed by URI, checked every pollInterval
+	subsMu       sync.Mutex
+	subs         map[string]*subscription
+	pollInterval time.Duration
 }
 
 func main() {
-	credentialsFile := os.Getenv("GOOGLE_OAUTH_CREDENTIALS")
-	tokenFile := os.Getenv("GOOGLE_TOKEN_FILE")
-
-	if credentialsFile == "" {
-		log.Fatal("GOOGLE_OAUTH_CREDENTIALS environment variable must be set")
+	profiles, err := configuredProfiles()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	if tokenFile == "" {
-		tokenFile = filepath.Join(filepath.Dir(credentialsFile), "tasks-token.json")
+	// Auth commands act on the profile named by GOOGLE_TASKS_ACCOUNT, or the default one
+	authProfile, err := findProfile(profiles, os.Getenv("GOOGLE_TASKS_ACCOUNT"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	credentialsFile, tokenFile := authProfile.Credentials, authProfile.Token
+
+	// Read-only mode asks Google for the readonly scope and exposes no tools that write
+	var readOnly bool
+	if v := os.Getenv("GOOGLE_TASKS_READONLY"); v != "" {
+		readOnly, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("Invalid GOOGLE_TASKS_READONLY %q: %v", v, err)
+		}
+	}
+	scope := oauthScope(readOnly)
+	authStore, err := newTokenStore(authProfile)
+	if err != nil {
+		log.Fatalf("Account %q: %v", authProfile.Name, err)
 	}
 
-	// Check for --auth flag (get URL)
+	// Check for --auth flag (authorize via loopback redirect, or print URL with --manual)
 	if len(os.Args) > 1 && os.Args[1] == "--auth" {
-		if err := runAuthFlow(credentialsFile, tokenFile); err != nil {
+		var err error
+		if len(os.Args) > 2 && os.Args[2] == "--manual" {
+			err = runManualAuthFlow(credentialsFile, scope, tokenFile)
+		} else {
+			err = runAuthFlow(credentialsFile, scope, authStore)
+		}
+		if err != nil {
+			log.Fatalf("Authorization failed: %v", err)
+		}
+		return
+	}
+
+	// Check for --auth-device flag (authorize by entering a code on another device)
+	if len(os.Args) > 1 && os.Args[1] == "--auth-device" {
+		if err := runDeviceAuthFlow(credentialsFile, scope, authStore); err != nil {
 			log.Fatalf("Authorization failed: %v", err)
 		}
 		return
 	}
 
-	// Check for --token flag (exchange code)
+	// Check for --token flag (finish --auth --manual with the redirect URL or code)
 	if len(os.Args) > 2 && os.Args[1] == "--token" {
 		code := os.Args[2]
-		if err := exchangeCode(credentialsFile, tokenFile, code); err != nil {
+		if err := exchangeCode(credentialsFile, scope, tokenFile, authStore, code); err != nil {
 			log.Fatalf("Token exchange failed: %v", err)
 		}
 		return
 	}
 
-	config, err := getOAuthConfig(credentialsFile)
-	if err != nil {
-		log.Fatalf("Failed to get OAuth config: %v", err)
+	// Check for --auth-status flag (report on the stored token and check that it still refreshes)
+	if len(os.Args) > 1 && os.Args[1] == "--auth-status" {
+		config, err := getOAuthConfig(credentialsFile, scope)
+		if err != nil {
+			log.Fatalf("Failed to get OAuth config: %v", err)
+		}
+		if err := authStatus(context.Background(), os.Stdout, authProfile.Name, config, authStore, tokenInfoURL); err != nil {
+			log.Fatalf("Authorization check failed: %v", err)
+		}
+		return
 	}
 
-	httpClient, err := getClient(config, tokenFile)
-	if err != nil {
-		log.Fatalf("Failed to get HTTP client: %v", err)
+	// Check for --logout flag (revoke the grant and delete the stored token)
+	if len(os.Args) > 1 && os.Args[1] == "--logout" {
+		if err := logout(context.Background(), os.Stdout, authStore, revokeURL); err != nil {
+			log.Fatalf("Logout failed: %v", err)
+		}
+		return
+	}
+
+	// Check for --migrate-token flag (move a plaintext token file into the configured store)
+	if len(os.Args) > 1 && os.Args[1] == "--migrate-token" {
+		if err := migrateToken(authProfile, authStore); err != nil {
+			log.Fatalf("Token migration failed: %v", err)
+		}
+		fmt.Printf("Token migrated to: %s\n", authStore)
+		return
 	}
 
 	timezone := os.Getenv("TIMEZONE")
@@ -109,20 +237,99 @@ func main() {
 		log.Fatalf("Invalid TIMEZONE %q: %v", timezone, err)
 	}
 
-	tasksClient, err := NewTasksClientOAuth(httpClient, loc)
-	if err != nil {
-		log.Fatalf("Failed to create tasks client: %v", err)
+	server := &Server{loc: loc, readOnly: readOnly}
+	for _, p := range profiles {
+		config, err := getOAuthConfig(p.Credentials, scope)
+		if err != nil {
+			log.Fatalf("Account %q: failed to get OAuth config: %v", p.Name, err)
+		}
+
+		store, err := newTokenStore(p)
+		if err != nil {
+			log.Fatalf("Account %q: %v", p.Name, err)
+		}
+
+		httpClient, tok, err := getClient(config, store)
+		if err != nil {
+			log.Fatalf("Account %q: failed to get HTTP client: %v", p.Name, err)
+		}
+
+		// Asking for the readonly scope only limits tokens minted from now on
+		if readOnly {
+			if err := checkReadOnlyGrant(context.Background(), tokenInfoURL, tok); err != nil {
+				log.Fatalf("Account %q: %v", p.Name, err)
+			}
+		}
+
+		tasksClient, err := NewTasksClientOAuth(httpClient, loc)
+		if err != nil {
+			log.Fatalf("Account %q: failed to create tasks client: %v", p.Name, err)
+		}
+
+		server.accounts = append(server.accounts, &account{name: p.Name, tasks: tasksClient})
+	}
+
+	if path := os.Getenv("GOOGLE_TASKS_POLICY"); path != "" {
+		server.policy, err = loadPolicy(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if v := os.Getenv("RESOURCE_POLL_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid RESOURCE_POLL_INTERVAL %q: %v", v, err)
+		}
+		server.pollInterval = interval
+	}
+
+	// Serve over HTTP instead of stdio when an address is given
+	httpAddr := os.Getenv("MCP_HTTP_ADDR")
+	if len(os.Args) > 2 && os.Args[1] == "--http" {
+		httpAddr = os.Args[2]
+	}
+	if httpAddr != "" {
+		config := httpConfig{token: os.Getenv("MCP_HTTP_TOKEN")}
+		if v := os.Getenv("MCP_HTTP_ALLOWED_ORIGINS"); v != "" {
+			for _, origin := range strings.Split(v, ",") {
+				config.origins = append(config.origins, strings.TrimSpace(origin))
+			}
+		}
+		if err := server.serveHTTP(httpAddr, config); err != nil {
+			log.Fatalf("HTTP server failed: %v", err)
+		}
+		return
 	}
 
-	server := &Server{tasks: tasksClient, loc: loc}
 	server.run()
 }
 
 func (s *Server) run() {
-	scanner := bufio.NewScanner(os.Stdin)
+	s.serve(context.Background(), os.Stdin, os.Stdout)
+}
+
+// serve reads newline-delimited JSON-RPC messages from in and writes responses to out.
+// apiMethods requests run concurrently, see runCall; they are cancelled by
+// notifications/cancelled or once in is exhausted.
+func (s *Server) serve(ctx context.Context, in io.Reader, out io.Writer) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.outMu.Lock()
+	s.out = out
+	s.outMu.Unlock()
+
+	// The stdio client receives resource notifications through the server itself
+	ctx = withNotifier(ctx, s)
+	go s.watchResources(ctx)
+
+	scanner := bufio.NewScanner(in)
 	buf := make([]byte, 0, 64*1024)
 	scanner.Buffer(buf, 1024*1024)
 
+	var wg sync.WaitGroup
+
 	for scanner.Scan() {
 		line := scanner.Bytes()
 		if len(line) == 0 {
@@ -135,16 +342,131 @@ func (s *Server) run() {
 			continue
 		}
 
-		response := s.handleRequest(req)
-		if response != nil {
-			s.sendResponse(response)
+		// Notifications never get a response
+		if req.ID == nil {
+			s.handleRequest(ctx, req)
+			continue
+		}
+
+		if !apiMethods[req.Method] {
+			if response := s.handleRequest(ctx, req); response != nil {
+				s.sendResponse(response)
+			}
+			continue
+		}
+
+		// Tracked before reading on, so a cancellation that follows finds it
+		reqCtx, done := s.trackRequest(ctx, req.ID)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer done()
+
+			if response := s.runCall(reqCtx, req); response != nil {
+				s.sendResponse(response)
+			}
+		}()
+	}
+
+	cancel()
+	wg.Wait()
+}
+
+// runCall handles an apiMethods request once one of maxConcurrentCalls slots,
+// shared by every client, is free. It returns nil if ctx was cancelled, as
+// cancelled requests must not be answered.
+func (s *Server) runCall(ctx context.Context, req JSONRPCRequest) *JSONRPCResponse {
+	s.callsOnce.Do(func() { s.calls = make(chan struct{}, maxConcurrentCalls) })
+
+	select {
+	case s.calls <- struct{}{}:
+		defer func() { <-s.calls }()
+	case <-ctx.Done():
+		return nil
+	}
+
+	response := s.handleRequest(ctx, req)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return response
+}
+
+// inflightKey names a running request; IDs are only unique per client.
+type inflightKey struct {
+	client notifier
+	id     string
+}
+
+type inflightCall struct {
+	cancel context.CancelFunc
+}
+
+// trackRequest derives a cancellable context for an in-flight request.
+// The returned func releases it and must be called when the request finishes.
+func (s *Server) trackRequest(ctx context.Context, id interface{}) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	key := inflightKey{client: notifierFrom(ctx), id: requestKey(id)}
+	call := &inflightCall{cancel: cancel}
+
+	s.inflightMu.Lock()
+	if s.inflight == nil {
+		s.inflight = make(map[inflightKey]*inflightCall)
+	}
+	s.inflight[key] = call
+	s.inflightMu.Unlock()
+
+	return ctx, func() {
+		s.inflightMu.Lock()
+		// A newer request may have reused the ID since
+		if s.inflight[key] == call {
+			delete(s.inflight, key)
 		}
+		s.inflightMu.Unlock()
+		cancel()
+	}
+}
+
+// cancelRequest handles notifications/cancelled by cancelling the named
+// request of the same client, if still running.
+func (s *Server) cancelRequest(ctx context.Context, params json.RawMessage) {
+	var input struct {
+		RequestID interface{} `json:"requestId"`
+	}
+	if err := json.Unmarshal(params, &input); err != nil || input.RequestID == nil {
+		return
+	}
+
+	s.inflightMu.Lock()
+	call, ok := s.inflight[inflightKey{client: notifierFrom(ctx), id: requestKey(input.RequestID)}]
+	s.inflightMu.Unlock()
+
+	if ok {
+		call.cancel()
 	}
 }
 
+// requestKey distinguishes numeric and string IDs with the same text.
+func requestKey(id interface{}) string {
+	return fmt.Sprintf("%T:%v", id, id)
+}
+
 func (s *Server) sendResponse(resp *JSONRPCResponse) {
-	data, _ := json.Marshal(resp)
-	fmt.Println(string(data))
+	s.writeMessage(resp)
+}
+
+// writeMessage writes one JSON-RPC message as a line on the stdio output.
+func (s *Server) writeMessage(msg interface{}) {
+	data, _ := json.Marshal(msg)
+
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+
+	out := s.out
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintln(out, string(data))
 }
 
 func (s *Server) sendError(id interface{}, code int, message string, data interface{}) {
@@ -160,16 +482,33 @@ func (s *Server) sendError(id interface{}, code int, message string, data interf
 	s.sendResponse(resp)
 }
 
-func (s *Server) handleRequest(req JSONRPCRequest) *JSONRPCResponse {
+func (s *Server) handleRequest(ctx context.Context, req JSONRPCRequest) *JSONRPCResponse {
 	switch req.Method {
 	case "initialize":
 		return s.handleInitialize(req)
-	case "initialized":
+	case "initialized", "notifications/initialized":
+		return nil
+	case "notifications/cancelled":
+		s.cancelRequest(ctx, req.Params)
 		return nil
 	case "tools/list":
 		return s.handleToolsList(req)
 	case "tools/call":
-		return s.handleToolsCall(req)
+		return s.handleToolsCall(ctx, req)
+	case "resources/list":
+		return s.handleResourcesList(ctx, req)
+	case "resources/templates/list":
+		return s.handleResourceTemplatesList(req)
+	case "resources/read":
+		return s.handleResourcesRead(ctx, req)
+	case "resources/subscribe":
+		return s.handleResourcesSubscribe(ctx, req)
+	case "resources/unsubscribe":
+		return s.handleResourcesUnsubscribe(ctx, req)
+	case "prompts/list":
+		return s.handlePromptsList(req)
+	case "prompts/get":
+		return s.handlePromptsGet(ctx, req)
 	default:
 		return &JSONRPCResponse{
 			JSONRPC: "2.0",
@@ -183,24 +522,53 @@ func (s *Server) handleRequest(req JSONRPCRequest) *JSONRPCResponse {
 }
 
 func (s *Server) handleInitialize(req JSONRPCRequest) *JSONRPCResponse {
+	var params struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if len(req.Params) > 0 {
+		json.Unmarshal(req.Params, &params)
+	}
+
+	// Agree to the client's version if we speak it, otherwise offer our latest
+	version := supportedProtocolVersions[0]
+	for _, v := range supportedProtocolVersions {
+		if v == params.ProtocolVersion {
+			version = v
+		}
+	}
+
 	return &JSONRPCResponse{
 		JSONRPC: "2.0",
 		ID:      req.ID,
 		Result: map[string]interface{}{
-			"protocolVersion": "2024-11-05",
+			"protocolVersion": version,
 			"serverInfo": map[string]string{
 				"name":    serverName,
 				"version": serverVersion,
 			},
 			"capabilities": map[string]interface{}{
 				"tools": map[string]interface{}{},
+				"resources": map[string]interface{}{
+					"subscribe": true,
+				},
+				"prompts": map[string]interface{}{},
 			},
 		},
 	}
 }
 
-func (s *Server) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
-	tools := []map[string]interface{}{
+// toolDefinitions returns every tool the server offers, before read-only mode,
+// policy and accounts are applied.
+func toolDefinitions() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"name":        toolListAccounts,
+			"description": "List the Google accounts this server can act for; pass a name as account to other tools",
+			"inputSchema": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
 		{
 			"name":        toolListTaskLists,
 			"description": "List all task lists",
@@ -209,6 +577,64 @@ func (s *Server) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 				"properties": map[string]interface{}{},
 			},
 		},
+		{
+			"name":        toolCreateTaskList,
+			"description": "Create a new task list",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"title": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list title",
+					},
+				},
+				"required": []string{"title"},
+			},
+		},
+		{
+			"name":        toolUpdateTaskList,
+			"description": "Rename a task list",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"tasklist_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list ID to rename (use list_task_lists to find IDs)",
+					},
+					"tasklist": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list name, matched case-insensitively (alternative to tasklist_id)",
+					},
+					"title": map[string]interface{}{
+						"type":        "string",
+						"description": "New task list title",
+					},
+				},
+				"required": []string{"title"},
+			},
+		},
+		{
+			"name":        toolDeleteTaskList,
+			"description": "Delete a task list and all of its tasks",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"tasklist_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list ID to delete (use list_task_lists to find IDs)",
+					},
+					"tasklist": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list name, matched case-insensitively (alternative to tasklist_id)",
+					},
+					"confirm": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Must be true to delete a list that still contains tasks (default: false)",
+						"default":     false,
+					},
+				},
+			},
+		},
 		{
 			"name":        toolListTasks,
 			"description": "List tasks from a task list",
@@ -220,11 +646,61 @@ func (s *Server) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 						"description": "Task list ID (use list_task_lists to find IDs, or '@default' for the default list)",
 						"default":     defaultTasklistID,
 					},
+					"tasklist": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list name, matched case-insensitively (alternative to tasklist_id)",
+					},
 					"show_completed": map[string]interface{}{
 						"type":        "boolean",
 						"description": "Include completed tasks (default: false)",
 						"default":     false,
 					},
+					"limit": map[string]interface{}{
+						"type":        "integer",
+						"description": "Maximum number of tasks to return (optional, default: all tasks)",
+						"minimum":     1,
+					},
+					"page_token": map[string]interface{}{
+						"type":        "string",
+						"description": "Token from a previous list_tasks response to fetch the next page (optional)",
+					},
+				},
+			},
+		},
+		{
+			"name":        toolSearchTasks,
+			"description": "Search tasks across all task lists (or a subset) by text, status and due date",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"query": map[string]interface{}{
+						"type":        "string",
+						"description": "Words to match against task title and notes, case-insensitive (optional)",
+					},
+					"status": map[string]interface{}{
+						"type":        "string",
+						"description": "Task status to match (default: needsAction)",
+						"enum":        []string{"needsAction", "completed", "any"},
+						"default":     "needsAction",
+					},
+					"due_after": map[string]interface{}{
+						"type":        "string",
+						"description": "Only tasks due on or after this date, YYYY-MM-DD (optional)",
+					},
+					"due_before": map[string]interface{}{
+						"type":        "string",
+						"description": "Only tasks due on or before this date, YYYY-MM-DD (optional)",
+					},
+					"tasklist_ids": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Task list IDs to search (optional, default: all lists)",
+					},
+					"tasklists": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Task list names to search (optional, default: all lists)",
+					},
 				},
 			},
 		},
@@ -239,6 +715,10 @@ func (s *Server) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 						"description": "Task list ID (use list_task_lists to find IDs, or '@default' for the default list)",
 						"default":     defaultTasklistID,
 					},
+					"tasklist": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list name, matched case-insensitively (alternative to tasklist_id)",
+					},
 					"title": map[string]interface{}{
 						"type":        "string",
 						"description": "Task title",
@@ -251,6 +731,10 @@ func (s *Server) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 						"type":        "string",
 						"description": "Due date in YYYY-MM-DD or YYYY-MM-DDTHH:MM format (optional)",
 					},
+					"parent_id": map[string]interface{}{
+						"type":        "string",
+						"description": "ID of the parent task to create this task as a subtask (optional)",
+					},
 				},
 				"required": []string{"title"},
 			},
@@ -266,6 +750,10 @@ func (s *Server) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 						"description": "Task list ID",
 						"default":     defaultTasklistID,
 					},
+					"tasklist": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list name, matched case-insensitively (alternative to tasklist_id)",
+					},
 					"task_id": map[string]interface{}{
 						"type":        "string",
 						"description": "Task ID to update (use list_tasks to find IDs)",
@@ -282,6 +770,15 @@ func (s *Server) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 						"type":        "string",
 						"description": "New due date in YYYY-MM-DD or YYYY-MM-DDTHH:MM format (optional)",
 					},
+					"status": map[string]interface{}{
+						"type":        "string",
+						"description": "New status; needsAction reopens a completed task (optional)",
+						"enum":        []string{"needsAction", "completed"},
+					},
+					"etag": map[string]interface{}{
+						"type":        "string",
+						"description": "ETag of the task as last read; the update is refused if the task changed since (optional)",
+					},
 				},
 				"required": []string{"task_id"},
 			},
@@ -297,6 +794,10 @@ func (s *Server) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 						"description": "Task list ID",
 						"default":     defaultTasklistID,
 					},
+					"tasklist": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list name, matched case-insensitively (alternative to tasklist_id)",
+					},
 					"task_id": map[string]interface{}{
 						"type":        "string",
 						"description": "Task ID to complete (use list_tasks to find IDs)",
@@ -305,6 +806,29 @@ func (s *Server) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 				"required": []string{"task_id"},
 			},
 		},
+		{
+			"name":        toolReopenTask,
+			"description": "Mark a completed task as not done again",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"tasklist_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list ID",
+						"default":     defaultTasklistID,
+					},
+					"tasklist": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list name, matched case-insensitively (alternative to tasklist_id)",
+					},
+					"task_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Task ID to reopen (use list_tasks with show_completed to find IDs)",
+					},
+				},
+				"required": []string{"task_id"},
+			},
+		},
 		{
 			"name":        toolDeleteTask,
 			"description": "Delete a task",
@@ -316,6 +840,10 @@ func (s *Server) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 						"description": "Task list ID",
 						"default":     defaultTasklistID,
 					},
+					"tasklist": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list name, matched case-insensitively (alternative to tasklist_id)",
+					},
 					"task_id": map[string]interface{}{
 						"type":        "string",
 						"description": "Task ID to delete (use list_tasks to find IDs)",
@@ -324,23 +852,159 @@ func (s *Server) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
 				"required": []string{"task_id"},
 			},
 		},
-	}
-
-	return &JSONRPCResponse{
-		JSONRPC: "2.0",
-		ID:      req.ID,
-		Result: map[string]interface{}{
-			"tools": tools,
+		{
+			"name":        toolMoveTask,
+			"description": "Move a task: reorder it, change its parent, or move it to another task list",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"tasklist_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list ID the task is currently in",
+						"default":     defaultTasklistID,
+					},
+					"tasklist": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list name, matched case-insensitively (alternative to tasklist_id)",
+					},
+					"task_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Task ID to move (use list_tasks to find IDs)",
+					},
+					"parent_id": map[string]interface{}{
+						"type":        "string",
+						"description": "New parent task ID (optional, omit to move to the top level)",
+					},
+					"previous_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Sibling task ID to place this task after (optional, omit to move to the first position)",
+					},
+					"destination_tasklist_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list ID to move the task into (optional, omit to stay in the current list)",
+					},
+					"destination_tasklist": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list name to move the task into (alternative to destination_tasklist_id)",
+					},
+				},
+				"required": []string{"task_id"},
+			},
 		},
-	}
-}
-
-func (s *Server) handleToolsCall(req JSONRPCRequest) *JSONRPCResponse {
-	var params struct {
-		Name      string          `json:"name"`
-		Arguments json.RawMessage `json:"arguments"`
-	}
-
+		{
+			"name":        toolClearCompleted,
+			"description": "Hide all completed tasks in a task list",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"tasklist_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list ID",
+						"default":     defaultTasklistID,
+					},
+					"tasklist": map[string]interface{}{
+						"type":        "string",
+						"description": "Task list name, matched case-insensitively (alternative to tasklist_id)",
+					},
+				},
+			},
+		},
+		{
+			"name":        toolBatch,
+			"description": "Run several task operations in one call, each reporting its own result. Operations on the same task list run in the order given; different lists are worked on concurrently",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"operations": map[string]interface{}{
+						"type":        "array",
+						"description": "Operations, each with op and the arguments of the matching tool (create_task, update_task, complete_task, delete_task or move_task)",
+						"maxItems":    maxBatchOperations,
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"op": map[string]interface{}{
+									"type": "string",
+									"enum": batchOpNames(),
+								},
+								"tasklist_id":             map[string]interface{}{"type": "string", "description": "Task list ID", "default": defaultTasklistID},
+								"tasklist":                map[string]interface{}{"type": "string", "description": "Task list name (alternative to tasklist_id)"},
+								"task_id":                 map[string]interface{}{"type": "string", "description": "Task ID, for every op but create"},
+								"title":                   map[string]interface{}{"type": "string"},
+								"notes":                   map[string]interface{}{"type": "string"},
+								"due":                     map[string]interface{}{"type": "string", "description": "Due date in YYYY-MM-DD or YYYY-MM-DDTHH:MM format"},
+								"status":                  map[string]interface{}{"type": "string", "enum": []string{"needsAction", "completed"}},
+								"etag":                    map[string]interface{}{"type": "string"},
+								"parent_id":               map[string]interface{}{"type": "string"},
+								"previous_id":             map[string]interface{}{"type": "string"},
+								"destination_tasklist_id": map[string]interface{}{"type": "string"},
+								"destination_tasklist":    map[string]interface{}{"type": "string"},
+							},
+							"required": []string{"op"},
+						},
+					},
+					"atomic": map[string]interface{}{
+						"type":        "boolean",
+						"description": "If an operation fails, skip the ones not yet started and delete the tasks the batch created",
+						"default":     false,
+					},
+				},
+				"required": []string{"operations"},
+			},
+		},
+	}
+}
+
+func (s *Server) handleToolsList(req JSONRPCRequest) *JSONRPCResponse {
+	tools := toolDefinitions()
+
+	allowed := tools[:0]
+	for _, tool := range tools {
+		name := tool["name"].(string)
+		if (s.readOnly && mutatingTools[name]) || !s.policy.allowsTool(name) {
+			continue
+		}
+		if patterns := s.policy.listPatterns(name); patterns != nil && name != toolListAccounts {
+			tool["description"] = fmt.Sprintf("%s. Restricted by policy to task lists matching: %s", tool["description"], strings.Join(patterns, ", "))
+		}
+		allowed = append(allowed, tool)
+	}
+	tools = allowed
+
+	accountNames := make([]string, len(s.accounts))
+	for i, a := range s.accounts {
+		accountNames[i] = a.name
+	}
+
+	for _, tool := range tools {
+		name := tool["name"].(string)
+		if schema, ok := outputSchemas[name]; ok {
+			tool["outputSchema"] = schema
+		}
+		if name != toolListAccounts {
+			props := tool["inputSchema"].(map[string]interface{})["properties"].(map[string]interface{})
+			props["account"] = map[string]interface{}{
+				"type":        "string",
+				"description": fmt.Sprintf("Account to act for (default: %s)", accountNames[0]),
+				"enum":        accountNames,
+			}
+		}
+	}
+
+	return &JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"tools": tools,
+		},
+	}
+}
+
+func (s *Server) handleToolsCall(ctx context.Context, req JSONRPCRequest) *JSONRPCResponse {
+	var params struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+
 	if err := json.Unmarshal(req.Params, &params); err != nil {
 		return &JSONRPCResponse{
 			JSONRPC: "2.0",
@@ -353,41 +1017,84 @@ func (s *Server) handleToolsCall(req JSONRPCRequest) *JSONRPCResponse {
 		}
 	}
 
-	ctx := context.Background()
+	if s.readOnly && mutatingTools[params.Name] {
+		return s.errorResponse(req.ID, fmt.Errorf("%s is not available, the server is in read-only mode", params.Name))
+	}
+	if !s.policy.allowsTool(params.Name) {
+		return s.errorResponse(req.ID, fmt.Errorf("%s is disabled by the server's policy", params.Name))
+	}
+
+	if params.Name == toolListAccounts {
+		return s.callListAccounts(req.ID)
+	}
+
+	acct, err := s.selectAccount(params.Arguments)
+	if err != nil {
+		return s.errorResponse(req.ID, err)
+	}
+	ctx = withAccount(ctx, acct)
+
+	if err := s.checkLists(ctx, params.Name, params.Arguments); err != nil {
+		return s.errorResponse(req.ID, err)
+	}
+
+	return s.dispatchTool(ctx, req.ID, params.Name, params.Arguments)
+}
 
-	switch params.Name {
+// dispatchTool runs a tool that has passed the read-only and policy checks.
+func (s *Server) dispatchTool(ctx context.Context, id interface{}, name string, args json.RawMessage) *JSONRPCResponse {
+	switch name {
 	case toolListTaskLists:
-		return s.callListTaskLists(ctx, req.ID)
+		return s.callListTaskLists(ctx, id)
+	case toolCreateTaskList:
+		return s.callCreateTaskList(ctx, id, args)
+	case toolUpdateTaskList:
+		return s.callUpdateTaskList(ctx, id, args)
+	case toolDeleteTaskList:
+		return s.callDeleteTaskList(ctx, id, args)
 	case toolListTasks:
-		return s.callListTasks(ctx, req.ID, params.Arguments)
+		return s.callListTasks(ctx, id, args)
+	case toolSearchTasks:
+		return s.callSearchTasks(ctx, id, args)
 	case toolCreateTask:
-		return s.callCreateTask(ctx, req.ID, params.Arguments)
+		return s.callCreateTask(ctx, id, args)
 	case toolUpdateTask:
-		return s.callUpdateTask(ctx, req.ID, params.Arguments)
+		return s.callUpdateTask(ctx, id, args)
 	case toolCompleteTask:
-		return s.callCompleteTask(ctx, req.ID, params.Arguments)
+		return s.callCompleteTask(ctx, id, args)
+	case toolReopenTask:
+		return s.callReopenTask(ctx, id, args)
 	case toolDeleteTask:
-		return s.callDeleteTask(ctx, req.ID, params.Arguments)
+		return s.callDeleteTask(ctx, id, args)
+	case toolMoveTask:
+		return s.callMoveTask(ctx, id, args)
+	case toolClearCompleted:
+		return s.callClearCompleted(ctx, id, args)
+	case toolBatch:
+		return s.callBatch(ctx, id, args)
 	default:
 		return &JSONRPCResponse{
 			JSONRPC: "2.0",
-			ID:      req.ID,
+			ID:      id,
 			Error: &RPCError{
 				Code:    -32602,
-				Message: "Unknown tool: " + params.Name,
+				Message: "Unknown tool: " + name,
 			},
 		}
 	}
 }
 
 func (s *Server) callListTaskLists(ctx context.Context, id interface{}) *JSONRPCResponse {
-	lists, err := s.tasks.ListTaskLists(ctx)
+	lists, err := s.cachedTaskLists(ctx, true)
 	if err != nil {
 		return s.errorResponse(id, err)
 	}
+	lists = s.policy.filterLists(toolListTaskLists, lists)
+
+	structured := map[string]interface{}{"task_lists": lists}
 
 	if len(lists) == 0 {
-		return s.successResponse(id, "No task lists found.")
+		return s.structuredResponse(id, "No task lists found.", structured)
 	}
 
 	result := fmt.Sprintf("Found %d task list(s):\n\n", len(lists))
@@ -395,60 +1102,355 @@ func (s *Server) callListTaskLists(ctx context.Context, id interface{}) *JSONRPC
 		result += fmt.Sprintf("- %s\n  ID: %s\n\n", l.Title, l.ID)
 	}
 
-	return s.successResponse(id, result)
+	return s.structuredResponse(id, result, structured)
+}
+
+func (s *Server) callCreateTaskList(ctx context.Context, id interface{}, args json.RawMessage) *JSONRPCResponse {
+	var input struct {
+		Title string `json:"title"`
+	}
+
+	if err := json.Unmarshal(args, &input); err != nil {
+		return s.paramError(id, "Invalid arguments", err.Error())
+	}
+
+	if input.Title == "" {
+		return s.paramError(id, "title is required", nil)
+	}
+
+	list, err := s.account(ctx).tasks.CreateTaskList(ctx, input.Title)
+	if err != nil {
+		return s.errorResponse(id, err)
+	}
+	s.invalidateTaskLists(ctx)
+
+	result := fmt.Sprintf("Task list created successfully!\nID: %s\nTitle: %s", list.Id, list.Title)
+	return s.structuredResponse(id, result, map[string]interface{}{"task_list": newTaskListItem(list)})
+}
+
+func (s *Server) callUpdateTaskList(ctx context.Context, id interface{}, args json.RawMessage) *JSONRPCResponse {
+	var input struct {
+		TasklistID string `json:"tasklist_id"`
+		Tasklist   string `json:"tasklist"`
+		Title      string `json:"title"`
+	}
+
+	if err := json.Unmarshal(args, &input); err != nil {
+		return s.paramError(id, "Invalid arguments", err.Error())
+	}
+
+	if input.TasklistID == "" && input.Tasklist == "" {
+		return s.paramError(id, "tasklist_id or tasklist is required (use list_task_lists to find task lists)", nil)
+	}
+
+	tasklistID, err := s.resolveTasklistExact(ctx, input.TasklistID, input.Tasklist)
+	if err != nil {
+		return s.errorResponse(id, err)
+	}
+
+	if input.Title == "" {
+		return s.paramError(id, "title is required", nil)
+	}
+
+	list, err := s.account(ctx).tasks.UpdateTaskList(ctx, tasklistID, input.Title)
+	if err != nil {
+		return s.errorResponse(id, err)
+	}
+	s.invalidateTaskLists(ctx)
+
+	result := fmt.Sprintf("Task list renamed successfully!\nID: %s\nTitle: %s", list.Id, list.Title)
+	return s.structuredResponse(id, result, map[string]interface{}{"task_list": newTaskListItem(list)})
+}
+
+func (s *Server) callDeleteTaskList(ctx context.Context, id interface{}, args json.RawMessage) *JSONRPCResponse {
+	var input struct {
+		TasklistID string `json:"tasklist_id"`
+		Tasklist   string `json:"tasklist"`
+		Confirm    bool   `json:"confirm"`
+	}
+
+	if err := json.Unmarshal(args, &input); err != nil {
+		return s.paramError(id, "Invalid arguments", err.Error())
+	}
+
+	if input.TasklistID == "" && input.Tasklist == "" {
+		return s.paramError(id, "tasklist_id or tasklist is required (use list_task_lists to find task lists)", nil)
+	}
+
+	tasklistID, err := s.resolveTasklistExact(ctx, input.TasklistID, input.Tasklist)
+	if err != nil {
+		return s.errorResponse(id, err)
+	}
+
+	if !input.Confirm {
+		// Cleared and hidden tasks are deleted with the list too
+		nonEmpty, err := s.account(ctx).tasks.HasTasks(ctx, tasklistID)
+		if err != nil {
+			return s.errorResponse(id, err)
+		}
+		if nonEmpty {
+			return s.errorResponse(id, fmt.Errorf("task list %s still contains tasks; call delete_task_list again with confirm set to true to delete it together with its tasks", tasklistID))
+		}
+	}
+
+	if err := s.account(ctx).tasks.DeleteTaskList(ctx, tasklistID); err != nil {
+		return s.errorResponse(id, err)
+	}
+	s.invalidateTaskLists(ctx)
+
+	return s.structuredResponse(id, "Task list deleted successfully!", map[string]interface{}{"deleted": true, "id": tasklistID})
 }
 
 func (s *Server) callListTasks(ctx context.Context, id interface{}, args json.RawMessage) *JSONRPCResponse {
 	var input struct {
 		TasklistID    string `json:"tasklist_id"`
+		Tasklist      string `json:"tasklist"`
 		ShowCompleted bool   `json:"show_completed"`
+		Limit         int    `json:"limit"`
+		PageToken     string `json:"page_token"`
 	}
-	input.TasklistID = defaultTasklistID
 
 	if len(args) > 0 {
-		json.Unmarshal(args, &input)
+		if err := json.Unmarshal(args, &input); err != nil {
+			return s.paramError(id, "Invalid arguments", err.Error())
+		}
+	}
+
+	tasklistID, err := s.resolveTasklist(ctx, input.TasklistID, input.Tasklist)
+	if err != nil {
+		return s.errorResponse(id, err)
 	}
 
-	if input.TasklistID == "" {
-		input.TasklistID = defaultTasklistID
+	if input.Limit < 0 {
+		return s.paramError(id, "limit must be a positive number", nil)
 	}
 
-	taskItems, err := s.tasks.ListTasks(ctx, input.TasklistID, input.ShowCompleted)
+	page, err := s.account(ctx).tasks.ListTasksPage(ctx, tasklistID, input.ShowCompleted, input.PageToken, input.Limit)
 	if err != nil {
 		return s.errorResponse(id, err)
 	}
 
-	if len(taskItems) == 0 {
-		return s.successResponse(id, "No tasks found.")
+	paged := input.Limit > 0 || input.PageToken != ""
+	structured := map[string]interface{}{"tasks": page.Items}
+	if page.NextPageToken != "" {
+		structured["next_page_token"] = page.NextPageToken
 	}
 
-	result := fmt.Sprintf("Found %d task(s):\n\n", len(taskItems))
-	for _, t := range taskItems {
-		status := "[ ]"
-		if t.Status == "completed" {
-			status = "[x]"
+	if len(page.Items) == 0 && page.NextPageToken == "" {
+		if paged {
+			return s.structuredResponse(id, "No more tasks.", structured)
+		}
+		return s.structuredResponse(id, "No tasks found.", structured)
+	}
+
+	result := fmt.Sprintf("Found %d task(s):\n\n", len(page.Items))
+	result += s.renderTaskTree(page.Items)
+
+	if page.NextPageToken != "" {
+		result += fmt.Sprintf("More tasks available. Call list_tasks again with page_token: %s", page.NextPageToken)
+	} else if paged {
+		result += "No more tasks after this page."
+	}
+
+	return s.structuredResponse(id, result, structured)
+}
+
+func (s *Server) callSearchTasks(ctx context.Context, id interface{}, args json.RawMessage) *JSONRPCResponse {
+	var input struct {
+		Query       string   `json:"query"`
+		Status      string   `json:"status"`
+		DueAfter    string   `json:"due_after"`
+		DueBefore   string   `json:"due_before"`
+		TasklistIDs []string `json:"tasklist_ids"`
+		Tasklists   []string `json:"tasklists"`
+	}
+
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &input); err != nil {
+			return s.paramError(id, "Invalid arguments", err.Error())
+		}
+	}
+
+	switch input.Status {
+	case "":
+		input.Status = "needsAction"
+	case "needsAction", "completed", "any":
+	default:
+		return s.paramError(id, "status must be one of needsAction, completed, any", nil)
+	}
+
+	// Tasks completed in Google's own apps are hidden, so ask for those too
+	filter := TaskFilter{ShowCompleted: input.Status != "needsAction", ShowHidden: input.Status != "needsAction"}
+	if input.DueAfter != "" {
+		dueMin, err := dueDate(input.DueAfter)
+		if err != nil {
+			return s.paramError(id, "Invalid due_after", err.Error())
+		}
+		filter.DueMin = dueMin.Format(time.RFC3339)
+	}
+	if input.DueBefore != "" {
+		dueMax, err := dayAfter(input.DueBefore)
+		if err != nil {
+			return s.paramError(id, "Invalid due_before", err.Error())
+		}
+		filter.DueMax = dueMax
+	}
+
+	lists, err := s.searchScope(ctx, input.TasklistIDs, input.Tasklists)
+	if err != nil {
+		return s.errorResponse(id, err)
+	}
+
+	terms := strings.Fields(strings.ToLower(input.Query))
+
+	var groups string
+	total, listCount := 0, 0
+	results := make([]map[string]interface{}, 0)
+	for _, l := range lists {
+		taskItems, err := s.account(ctx).tasks.FilterTasks(ctx, l.ID, filter)
+		if err != nil {
+			return s.errorResponse(id, fmt.Errorf("searching task list %q: %w", l.Title, err))
 		}
-		result += fmt.Sprintf("%s %s\n", status, t.Title)
-		if t.Notes != "" {
-			result += fmt.Sprintf("  Notes: %s\n", t.Notes)
+
+		matched := make([]TaskItem, 0)
+		for _, t := range taskItems {
+			if input.Status != "any" && t.Status != input.Status {
+				continue
+			}
+			if !matchesTerms(t, terms) {
+				continue
+			}
+			matched = append(matched, t)
 		}
-		if t.Due != "" {
-			result += fmt.Sprintf("  Due: %s\n", formatDue(t.Due, s.loc))
+		if len(matched) == 0 {
+			continue
 		}
-		result += fmt.Sprintf("  ID: %s\n\n", t.ID)
+
+		total += len(matched)
+		listCount++
+		results = append(results, map[string]interface{}{"task_list": l, "tasks": matched})
+		groups += fmt.Sprintf("== %s (ID: %s) ==\n\n", l.Title, l.ID)
+		groups += s.renderTaskTree(matched)
 	}
 
-	return s.successResponse(id, result)
+	structured := map[string]interface{}{"total": total, "results": results}
+
+	if total == 0 {
+		return s.structuredResponse(id, "No matching tasks found.", structured)
+	}
+
+	result := fmt.Sprintf("Found %d matching task(s) in %d list(s):\n\n", total, listCount) + groups
+	return s.structuredResponse(id, result, structured)
+}
+
+// searchScope returns the task lists a search should cover: the ones named by
+// ids or names, or every task list when neither is given.
+func (s *Server) searchScope(ctx context.Context, ids, names []string) ([]TaskListItem, error) {
+	all, err := s.cachedTaskLists(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 && len(names) == 0 {
+		return s.policy.filterLists(toolSearchTasks, all), nil
+	}
+
+	titles := make(map[string]string, len(all))
+	for _, l := range all {
+		titles[l.ID] = l.Title
+	}
+
+	for _, name := range names {
+		listID, err := s.resolveTasklist(ctx, "", name)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, listID)
+	}
+
+	seen := make(map[string]bool)
+	scope := make([]TaskListItem, 0, len(ids))
+	for _, listID := range ids {
+		if seen[listID] {
+			continue
+		}
+		seen[listID] = true
+		title, ok := titles[listID]
+		if !ok {
+			title = listID
+		}
+		scope = append(scope, TaskListItem{ID: listID, Title: title})
+	}
+
+	return scope, nil
+}
+
+// matchesTerms reports whether every term appears in the task title or notes.
+func matchesTerms(t TaskItem, terms []string) bool {
+	text := strings.ToLower(t.Title + "\n" + t.Notes)
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// renderTaskTree formats tasks as an indented tree, ordering siblings by position.
+// Tasks whose parent is not among items are rendered at the top level.
+func (s *Server) renderTaskTree(items []TaskItem) string {
+	known := make(map[string]bool, len(items))
+	for _, t := range items {
+		known[t.ID] = true
+	}
+
+	children := make(map[string][]TaskItem)
+	for _, t := range items {
+		parent := t.Parent
+		if !known[parent] {
+			parent = ""
+		}
+		children[parent] = append(children[parent], t)
+	}
+	for _, siblings := range children {
+		sort.SliceStable(siblings, func(i, j int) bool {
+			return siblings[i].Position < siblings[j].Position
+		})
+	}
+
+	var result string
+	var render func(parent string, depth int)
+	render = func(parent string, depth int) {
+		indent := strings.Repeat("    ", depth)
+		for _, t := range children[parent] {
+			status := "[ ]"
+			if t.Status == "completed" {
+				status = "[x]"
+			}
+			result += fmt.Sprintf("%s%s %s\n", indent, status, t.Title)
+			if t.Notes != "" {
+				result += fmt.Sprintf("%s  Notes: %s\n", indent, t.Notes)
+			}
+			if t.Due != "" {
+				result += fmt.Sprintf("%s  Due: %s\n", indent, formatDue(t.Due, s.loc))
+			}
+			result += fmt.Sprintf("%s  ID: %s\n\n", indent, t.ID)
+			render(t.ID, depth+1)
+		}
+	}
+	render("", 0)
+
+	return result
 }
 
 func (s *Server) callCreateTask(ctx context.Context, id interface{}, args json.RawMessage) *JSONRPCResponse {
 	var input struct {
 		TasklistID string `json:"tasklist_id"`
+		Tasklist   string `json:"tasklist"`
 		Title      string `json:"title"`
 		Notes      string `json:"notes"`
 		Due        string `json:"due"`
+		ParentID   string `json:"parent_id"`
 	}
-	input.TasklistID = defaultTasklistID
 
 	if err := json.Unmarshal(args, &input); err != nil {
 		return s.paramError(id, "Invalid arguments", err.Error())
@@ -458,32 +1460,38 @@ func (s *Server) callCreateTask(ctx context.Context, id interface{}, args json.R
 		return s.paramError(id, "title is required", nil)
 	}
 
-	if input.TasklistID == "" {
-		input.TasklistID = defaultTasklistID
+	tasklistID, err := s.resolveTasklistExact(ctx, input.TasklistID, input.Tasklist)
+	if err != nil {
+		return s.errorResponse(id, err)
 	}
 
-	task, err := s.tasks.CreateTask(ctx, input.TasklistID, input.Title, input.Notes, input.Due)
+	task, err := s.account(ctx).tasks.CreateTask(ctx, tasklistID, input.Title, input.Notes, input.Due, input.ParentID)
 	if err != nil {
 		return s.errorResponse(id, err)
 	}
 
 	result := fmt.Sprintf("Task created successfully!\nID: %s\nTitle: %s", task.Id, task.Title)
+	if task.Parent != "" {
+		result += fmt.Sprintf("\nParent: %s", task.Parent)
+	}
 	if task.Due != "" {
 		result += fmt.Sprintf("\nDue: %s", formatDue(task.Due, s.loc))
 	}
 
-	return s.successResponse(id, result)
+	return s.structuredResponse(id, result, map[string]interface{}{"task": newTaskItem(task)})
 }
 
 func (s *Server) callUpdateTask(ctx context.Context, id interface{}, args json.RawMessage) *JSONRPCResponse {
 	var input struct {
 		TasklistID string  `json:"tasklist_id"`
+		Tasklist   string  `json:"tasklist"`
 		TaskID     string  `json:"task_id"`
 		Title      *string `json:"title"`
 		Notes      *string `json:"notes"`
 		Due        *string `json:"due"`
+		Status     *string `json:"status"`
+		ETag       string  `json:"etag"`
 	}
-	input.TasklistID = defaultTasklistID
 
 	if err := json.Unmarshal(args, &input); err != nil {
 		return s.paramError(id, "Invalid arguments", err.Error())
@@ -493,31 +1501,56 @@ func (s *Server) callUpdateTask(ctx context.Context, id interface{}, args json.R
 		return s.paramError(id, "task_id is required (use list_tasks to find task IDs)", nil)
 	}
 
-	if input.TasklistID == "" {
-		input.TasklistID = defaultTasklistID
+	if input.Status != nil && *input.Status != "needsAction" && *input.Status != "completed" {
+		return s.paramError(id, "status must be one of needsAction, completed", nil)
+	}
+
+	tasklistID, err := s.resolveTasklistExact(ctx, input.TasklistID, input.Tasklist)
+	if err != nil {
+		return s.errorResponse(id, err)
+	}
+
+	// Reopening clears the completion time, so read it first to report it
+	var prior *tasks.Task
+	if input.Status != nil && *input.Status == "needsAction" {
+		prior, err = s.account(ctx).tasks.GetTask(ctx, tasklistID, input.TaskID)
+		if err != nil {
+			return s.errorResponse(id, err)
+		}
 	}
 
 	updates := TaskUpdates{
-		Title: input.Title,
-		Notes: input.Notes,
-		Due:   input.Due,
+		Title:  input.Title,
+		Notes:  input.Notes,
+		Due:    input.Due,
+		Status: input.Status,
+		ETag:   input.ETag,
 	}
 
-	task, err := s.tasks.UpdateTask(ctx, input.TasklistID, input.TaskID, updates)
+	task, err := s.account(ctx).tasks.UpdateTask(ctx, tasklistID, input.TaskID, updates)
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		return s.errorResponse(id, fmt.Errorf("%v\n\nCurrent version:\n%s\nWith your changes:\n%s\nCheck that your changes still make sense, then retry with etag %q",
+			conflict, s.renderTaskTree([]TaskItem{newTaskItem(conflict.Current)}), s.renderTaskTree([]TaskItem{newTaskItem(conflict.Proposed)}), conflict.Current.Etag))
+	}
 	if err != nil {
 		return s.errorResponse(id, err)
 	}
 
-	result := fmt.Sprintf("Task updated successfully!\nID: %s\nTitle: %s", task.Id, task.Title)
-	return s.successResponse(id, result)
+	result := fmt.Sprintf("Task updated successfully!\nID: %s\nTitle: %s\nETag: %s", task.Id, task.Title, task.Etag)
+	structured := map[string]interface{}{"task": newTaskItem(task)}
+	if prior != nil {
+		result += s.reopenedNote(prior, structured)
+	}
+	return s.structuredResponse(id, result, structured)
 }
 
 func (s *Server) callCompleteTask(ctx context.Context, id interface{}, args json.RawMessage) *JSONRPCResponse {
 	var input struct {
 		TasklistID string `json:"tasklist_id"`
+		Tasklist   string `json:"tasklist"`
 		TaskID     string `json:"task_id"`
 	}
-	input.TasklistID = defaultTasklistID
 
 	if err := json.Unmarshal(args, &input); err != nil {
 		return s.paramError(id, "Invalid arguments", err.Error())
@@ -527,25 +1560,73 @@ func (s *Server) callCompleteTask(ctx context.Context, id interface{}, args json
 		return s.paramError(id, "task_id is required (use list_tasks to find task IDs)", nil)
 	}
 
-	if input.TasklistID == "" {
-		input.TasklistID = defaultTasklistID
+	tasklistID, err := s.resolveTasklistExact(ctx, input.TasklistID, input.Tasklist)
+	if err != nil {
+		return s.errorResponse(id, err)
 	}
 
-	task, err := s.tasks.CompleteTask(ctx, input.TasklistID, input.TaskID)
+	task, err := s.account(ctx).tasks.CompleteTask(ctx, tasklistID, input.TaskID)
 	if err != nil {
 		return s.errorResponse(id, err)
 	}
 
 	result := fmt.Sprintf("Task completed!\nID: %s\nTitle: %s", task.Id, task.Title)
-	return s.successResponse(id, result)
+	return s.structuredResponse(id, result, map[string]interface{}{"task": newTaskItem(task)})
+}
+
+func (s *Server) callReopenTask(ctx context.Context, id interface{}, args json.RawMessage) *JSONRPCResponse {
+	var input struct {
+		TasklistID string `json:"tasklist_id"`
+		Tasklist   string `json:"tasklist"`
+		TaskID     string `json:"task_id"`
+	}
+
+	if err := json.Unmarshal(args, &input); err != nil {
+		return s.paramError(id, "Invalid arguments", err.Error())
+	}
+
+	if input.TaskID == "" {
+		return s.paramError(id, "task_id is required (use list_tasks to find task IDs)", nil)
+	}
+
+	tasklistID, err := s.resolveTasklistExact(ctx, input.TasklistID, input.Tasklist)
+	if err != nil {
+		return s.errorResponse(id, err)
+	}
+
+	prior, err := s.account(ctx).tasks.GetTask(ctx, tasklistID, input.TaskID)
+	if err != nil {
+		return s.errorResponse(id, err)
+	}
+
+	status := "needsAction"
+	task, err := s.account(ctx).tasks.UpdateTask(ctx, tasklistID, input.TaskID, TaskUpdates{Status: &status})
+	if err != nil {
+		return s.errorResponse(id, err)
+	}
+
+	result := fmt.Sprintf("Task reopened!\nID: %s\nTitle: %s", task.Id, task.Title)
+	structured := map[string]interface{}{"task": newTaskItem(task)}
+	result += s.reopenedNote(prior, structured)
+	return s.structuredResponse(id, result, structured)
+}
+
+// reopenedNote describes the completion time a reopened task had before, and
+// adds it to structured as previously_completed.
+func (s *Server) reopenedNote(prior *tasks.Task, structured map[string]interface{}) string {
+	if prior.Completed == nil || *prior.Completed == "" {
+		return "\nThe task was not completed."
+	}
+	structured["previously_completed"] = *prior.Completed
+	return fmt.Sprintf("\nCleared completion time: %s", formatDue(*prior.Completed, s.loc))
 }
 
 func (s *Server) callDeleteTask(ctx context.Context, id interface{}, args json.RawMessage) *JSONRPCResponse {
 	var input struct {
 		TasklistID string `json:"tasklist_id"`
+		Tasklist   string `json:"tasklist"`
 		TaskID     string `json:"task_id"`
 	}
-	input.TasklistID = defaultTasklistID
 
 	if err := json.Unmarshal(args, &input); err != nil {
 		return s.paramError(id, "Invalid arguments", err.Error())
@@ -555,16 +1636,110 @@ func (s *Server) callDeleteTask(ctx context.Context, id interface{}, args json.R
 		return s.paramError(id, "task_id is required (use list_tasks to find task IDs)", nil)
 	}
 
-	if input.TasklistID == "" {
-		input.TasklistID = defaultTasklistID
+	tasklistID, err := s.resolveTasklistExact(ctx, input.TasklistID, input.Tasklist)
+	if err != nil {
+		return s.errorResponse(id, err)
+	}
+
+	if err := s.account(ctx).tasks.DeleteTask(ctx, tasklistID, input.TaskID); err != nil {
+		return s.errorResponse(id, err)
+	}
+
+	return s.structuredResponse(id, "Task deleted successfully!", map[string]interface{}{"deleted": true, "id": input.TaskID})
+}
+
+func (s *Server) callMoveTask(ctx context.Context, id interface{}, args json.RawMessage) *JSONRPCResponse {
+	var input struct {
+		TasklistID            string `json:"tasklist_id"`
+		Tasklist              string `json:"tasklist"`
+		TaskID                string `json:"task_id"`
+		ParentID              string `json:"parent_id"`
+		PreviousID            string `json:"previous_id"`
+		DestinationTasklistID string `json:"destination_tasklist_id"`
+		DestinationTasklist   string `json:"destination_tasklist"`
+	}
+
+	if err := json.Unmarshal(args, &input); err != nil {
+		return s.paramError(id, "Invalid arguments", err.Error())
+	}
+
+	if input.TaskID == "" {
+		return s.paramError(id, "task_id is required (use list_tasks to find task IDs)", nil)
+	}
+
+	tasklistID, err := s.resolveTasklistExact(ctx, input.TasklistID, input.Tasklist)
+	if err != nil {
+		return s.errorResponse(id, err)
+	}
+
+	destinationID := ""
+	if input.DestinationTasklistID != "" || input.DestinationTasklist != "" {
+		destinationID, err = s.resolveTasklistExact(ctx, input.DestinationTasklistID, input.DestinationTasklist)
+		if err != nil {
+			return s.errorResponse(id, err)
+		}
+	}
+
+	task, err := s.account(ctx).tasks.MoveTask(ctx, tasklistID, input.TaskID, input.ParentID, input.PreviousID, destinationID)
+	if err != nil {
+		return s.errorResponse(id, err)
+	}
+
+	list := tasklistID
+	if destinationID != "" {
+		list = destinationID
+	}
+	parent := "(top level)"
+	if task.Parent != "" {
+		parent = task.Parent
+	}
+
+	result := fmt.Sprintf("Task moved!\nID: %s\nTitle: %s\nList: %s\nParent: %s\nPosition: %s",
+		task.Id, task.Title, list, parent, task.Position)
+	return s.structuredResponse(id, result, map[string]interface{}{"task": newTaskItem(task), "tasklist_id": list})
+}
+
+func (s *Server) callClearCompleted(ctx context.Context, id interface{}, args json.RawMessage) *JSONRPCResponse {
+	var input struct {
+		TasklistID string `json:"tasklist_id"`
+		Tasklist   string `json:"tasklist"`
+	}
+
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &input); err != nil {
+			return s.paramError(id, "Invalid arguments", err.Error())
+		}
+	}
+
+	tasklistID, err := s.resolveTasklistExact(ctx, input.TasklistID, input.Tasklist)
+	if err != nil {
+		return s.errorResponse(id, err)
 	}
 
-	err := s.tasks.DeleteTask(ctx, input.TasklistID, input.TaskID)
+	// Clear doesn't report what it hid, so count the visible completed tasks first
+	taskItems, err := s.account(ctx).tasks.ListTasks(ctx, tasklistID, true)
 	if err != nil {
 		return s.errorResponse(id, err)
 	}
 
-	return s.successResponse(id, "Task deleted successfully!")
+	count := 0
+	for _, t := range taskItems {
+		if t.Status == "completed" {
+			count++
+		}
+	}
+
+	structured := map[string]interface{}{"cleared": count, "tasklist_id": tasklistID}
+
+	if count == 0 {
+		return s.structuredResponse(id, "No completed tasks to clear.", structured)
+	}
+
+	if err := s.account(ctx).tasks.ClearCompleted(ctx, tasklistID); err != nil {
+		return s.errorResponse(id, err)
+	}
+
+	return s.structuredResponse(id, fmt.Sprintf("Cleared %d completed task(s).", count), structured)
 }
 
 func (s *Server) successResponse(id interface{}, text string) *JSONRPCResponse {
@@ -579,7 +1754,19 @@ func (s *Server) successResponse(id interface{}, text string) *JSONRPCResponse {
 	}
 }
 
+// structuredResponse returns text content along with the same data as structuredContent.
+func (s *Server) structuredResponse(id interface{}, text string, data map[string]interface{}) *JSONRPCResponse {
+	resp := s.successResponse(id, text)
+	resp.Result.(map[string]interface{})["structuredContent"] = data
+	return resp
+}
+
 func (s *Server) errorResponse(id interface{}, err error) *JSONRPCResponse {
+	// Spell out what to do rather than burying it in the transport error
+	if errors.Is(err, errReauthRequired) {
+		err = errReauthRequired
+	}
+
 	return &JSONRPCResponse{
 		JSONRPC: "2.0",
 		ID:      id,
@@ -603,3 +1790,15 @@ func (s *Server) paramError(id interface{}, message string, data interface{}) *J
 		},
 	}
 }
+
+func (s *Server) rpcError(id interface{}, code int, message string, data interface{}) *JSONRPCResponse {
+	return &JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error: &RPCError{
+			Code:    code,
+			Message: message,
+			Data:    data,
+		},
+	}
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -18,29 +22,114 @@ type fakeTasks struct {
 	updated       *tasks.Task
 	completed     *tasks.Task
 	deleteErr     error
+	nextPageToken string
 	lastTasklist  string
 	lastTaskID    string
 	lastCompleted bool
+	lastPageToken string
+	lastLimit     int
+	lastParent    string
+	moved         *tasks.Task
+	lastPrevious  string
+	lastDest      string
+	createdList   *tasks.TaskList
+	updatedList   *tasks.TaskList
+	deletedList   string
+	lastTitle     string
+	clearedList   string
+	listCalls     int
+	tasksByList   map[string][]TaskItem
+	lastFilter    TaskFilter
+	searchedLists []string
+	task          *tasks.Task
+	lastUpdates   TaskUpdates
+	defaultList   *tasks.TaskList
+	hiddenItems   []TaskItem
 }
 
 func (f *fakeTasks) ListTaskLists(_ context.Context) ([]TaskListItem, error) {
+	f.listCalls++
 	return f.taskLists, f.err
 }
 
+// GetTaskList returns defaultList for @default, which falls back to the first
+// of taskLists, and any other list by ID
+func (f *fakeTasks) GetTaskList(_ context.Context, tasklistID string) (*tasks.TaskList, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if tasklistID == defaultTasklistID && f.defaultList != nil {
+		return f.defaultList, nil
+	}
+	for i, l := range f.taskLists {
+		if l.ID == tasklistID || (tasklistID == defaultTasklistID && i == 0) {
+			return &tasks.TaskList{Id: l.ID, Title: l.Title}, nil
+		}
+	}
+	return nil, fmt.Errorf("task list %s not found", tasklistID)
+}
+
+func (f *fakeTasks) CreateTaskList(_ context.Context, title string) (*tasks.TaskList, error) {
+	f.lastTitle = title
+	return f.createdList, f.err
+}
+
+func (f *fakeTasks) UpdateTaskList(_ context.Context, tasklistID, title string) (*tasks.TaskList, error) {
+	f.lastTasklist = tasklistID
+	f.lastTitle = title
+	return f.updatedList, f.err
+}
+
+func (f *fakeTasks) DeleteTaskList(_ context.Context, tasklistID string) error {
+	f.deletedList = tasklistID
+	return f.deleteErr
+}
+
 func (f *fakeTasks) ListTasks(_ context.Context, tasklistID string, showCompleted bool) ([]TaskItem, error) {
 	f.lastTasklist = tasklistID
 	f.lastCompleted = showCompleted
+	if f.tasksByList != nil {
+		return f.tasksByList[tasklistID], f.err
+	}
 	return f.taskItems, f.err
 }
 
-func (f *fakeTasks) CreateTask(_ context.Context, tasklistID, title, notes, due string) (*tasks.Task, error) {
+func (f *fakeTasks) ListTasksPage(_ context.Context, tasklistID string, showCompleted bool, pageToken string, limit int) (*TaskPage, error) {
 	f.lastTasklist = tasklistID
+	f.lastCompleted = showCompleted
+	f.lastPageToken = pageToken
+	f.lastLimit = limit
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &TaskPage{Items: f.taskItems, NextPageToken: f.nextPageToken}, nil
+}
+
+func (f *fakeTasks) FilterTasks(_ context.Context, tasklistID string, filter TaskFilter) ([]TaskItem, error) {
+	f.lastFilter = filter
+	f.searchedLists = append(f.searchedLists, tasklistID)
+	if f.tasksByList != nil {
+		return f.tasksByList[tasklistID], f.err
+	}
+	return f.taskItems, f.err
+}
+
+// HasTasks counts hiddenItems, which the list calls never return
+func (f *fakeTasks) HasTasks(_ context.Context, tasklistID string) (bool, error) {
+	f.lastTasklist = tasklistID
+	return len(f.taskItems)+len(f.hiddenItems) > 0, f.err
+}
+
+func (f *fakeTasks) CreateTask(_ context.Context, tasklistID, title, notes, due, parentID string) (*tasks.Task, error) {
+	f.lastTasklist = tasklistID
+	f.lastParent = parentID
 	return f.created, f.err
 }
 
 func (f *fakeTasks) UpdateTask(_ context.Context, tasklistID, taskID string, updates TaskUpdates) (*tasks.Task, error) {
 	f.lastTasklist = tasklistID
 	f.lastTaskID = taskID
+	f.lastUpdates = updates
 	return f.updated, f.err
 }
 
@@ -56,22 +145,42 @@ func (f *fakeTasks) DeleteTask(_ context.Context, tasklistID, taskID string) err
 	return f.deleteErr
 }
 
+func (f *fakeTasks) MoveTask(_ context.Context, tasklistID, taskID, parentID, previousID, destinationTasklistID string) (*tasks.Task, error) {
+	f.lastTasklist = tasklistID
+	f.lastTaskID = taskID
+	f.lastParent = parentID
+	f.lastPrevious = previousID
+	f.lastDest = destinationTasklistID
+	return f.moved, f.err
+}
+
+func (f *fakeTasks) ClearCompleted(_ context.Context, tasklistID string) error {
+	f.clearedList = tasklistID
+	return f.err
+}
+
 func newTestServer(fake *fakeTasks) *Server {
-	return &Server{tasks: fake, loc: time.UTC}
+	return &Server{accounts: []*account{{name: defaultAccountName, tasks: fake}}, loc: time.UTC}
+}
+
+func (f *fakeTasks) GetTask(_ context.Context, tasklistID, taskID string) (*tasks.Task, error) {
+	f.lastTasklist = tasklistID
+	f.lastTaskID = taskID
+	return f.task, f.err
 }
 
 func TestHandleInitialize(t *testing.T) {
 	s := newTestServer(&fakeTasks{})
 	req := JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "initialize"}
 
-	resp := s.handleRequest(req)
+	resp := s.handleRequest(context.Background(), req)
 	if resp == nil {
 		t.Fatal("expected response")
 	}
 
 	result := resp.Result.(map[string]interface{})
-	if result["protocolVersion"] != "2024-11-05" {
-		t.Errorf("expected protocol version 2024-11-05, got %v", result["protocolVersion"])
+	if result["protocolVersion"] != "2025-06-18" {
+		t.Errorf("expected protocol version 2025-06-18, got %v", result["protocolVersion"])
 	}
 
 	serverInfo := result["serverInfo"].(map[string]string)
@@ -80,9 +189,28 @@ func TestHandleInitialize(t *testing.T) {
 	}
 }
 
+func TestHandleInitialize_NegotiatesVersion(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+
+	tests := map[string]string{
+		"2024-11-05": "2024-11-05",
+		"2025-03-26": "2025-03-26",
+		"2025-06-18": "2025-06-18",
+		"1999-01-01": "2025-06-18",
+	}
+	for requested, expected := range tests {
+		params, _ := json.Marshal(map[string]string{"protocolVersion": requested})
+		resp := s.handleRequest(context.Background(), JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "initialize", Params: params})
+		result := resp.Result.(map[string]interface{})
+		if result["protocolVersion"] != expected {
+			t.Errorf("requested %s: expected %s, got %v", requested, expected, result["protocolVersion"])
+		}
+	}
+}
+
 func TestHandleInitialized(t *testing.T) {
 	s := newTestServer(&fakeTasks{})
-	resp := s.handleRequest(JSONRPCRequest{JSONRPC: "2.0", Method: "initialized"})
+	resp := s.handleRequest(context.Background(), JSONRPCRequest{JSONRPC: "2.0", Method: "initialized"})
 	if resp != nil {
 		t.Error("expected nil response for initialized notification")
 	}
@@ -90,7 +218,7 @@ func TestHandleInitialized(t *testing.T) {
 
 func TestHandleUnknownMethod(t *testing.T) {
 	s := newTestServer(&fakeTasks{})
-	resp := s.handleRequest(JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "unknown"})
+	resp := s.handleRequest(context.Background(), JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "unknown"})
 	if resp.Error == nil || resp.Error.Code != -32601 {
 		t.Error("expected method not found error")
 	}
@@ -100,11 +228,11 @@ func TestHandleToolsList(t *testing.T) {
 	s := newTestServer(&fakeTasks{})
 	req := JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "tools/list"}
 
-	resp := s.handleRequest(req)
+	resp := s.handleRequest(context.Background(), req)
 	result := resp.Result.(map[string]interface{})
 	tools := result["tools"].([]map[string]interface{})
 
-	expected := []string{"list_task_lists", "list_tasks", "create_task", "update_task", "complete_task", "delete_task"}
+	expected := []string{"list_accounts", "list_task_lists", "create_task_list", "update_task_list", "delete_task_list", "list_tasks", "search_tasks", "create_task", "update_task", "complete_task", "reopen_task", "delete_task", "move_task", "clear_completed", "batch"}
 	if len(tools) != len(expected) {
 		t.Fatalf("expected %d tools, got %d", len(expected), len(tools))
 	}
@@ -115,17 +243,280 @@ func TestHandleToolsList(t *testing.T) {
 	}
 }
 
+func TestHandleToolsList_OutputSchemas(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+	resp := s.handleRequest(context.Background(), JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "tools/list"})
+	tools := resp.Result.(map[string]interface{})["tools"].([]map[string]interface{})
+
+	for _, tool := range tools {
+		schema, ok := tool["outputSchema"].(map[string]interface{})
+		if !ok {
+			t.Errorf("tool %s: missing outputSchema", tool["name"])
+			continue
+		}
+		if schema["type"] != "object" {
+			t.Errorf("tool %s: expected object output schema, got %v", tool["name"], schema["type"])
+		}
+	}
+}
+
 func TestCallUnknownTool(t *testing.T) {
 	s := newTestServer(&fakeTasks{})
 	params, _ := json.Marshal(map[string]interface{}{"name": "nonexistent"})
 	req := JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "tools/call", Params: params}
 
-	resp := s.handleRequest(req)
+	resp := s.handleRequest(context.Background(), req)
 	if resp.Error == nil || resp.Error.Code != -32602 {
 		t.Error("expected invalid params error for unknown tool")
 	}
 }
 
+func TestHandleToolsList_ReadOnly(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+	s.readOnly = true
+
+	resp := s.handleRequest(context.Background(), JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "tools/list"})
+	tools := resp.Result.(map[string]interface{})["tools"].([]map[string]interface{})
+
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool["name"].(string))
+	}
+	if strings.Join(names, ",") != "list_accounts,list_task_lists,list_tasks,search_tasks" {
+		t.Errorf("expected only read tools, got %v", names)
+	}
+}
+
+func TestCallTool_ReadOnlyRejectsWrites(t *testing.T) {
+	fake := &fakeTasks{
+		taskLists: []TaskListItem{{ID: "list1", Title: "Work"}},
+		created:   &tasks.Task{Id: "t1", Title: "New"},
+	}
+	s := newTestServer(fake)
+	s.readOnly = true
+
+	for name := range mutatingTools {
+		params, _ := json.Marshal(map[string]interface{}{
+			"name":      name,
+			"arguments": map[string]string{"title": "New", "task_id": "t1", "tasklist_id": "list1"},
+		})
+		resp := s.handleRequest(context.Background(), JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "tools/call", Params: params})
+
+		result := resp.Result.(map[string]interface{})
+		if result["isError"] != true {
+			t.Errorf("%s: expected tool error in read-only mode, got %v", name, result)
+			continue
+		}
+		text := result["content"].([]map[string]string)[0]["text"]
+		if !strings.Contains(text, "read-only mode") {
+			t.Errorf("%s: expected read-only explanation, got %q", name, text)
+		}
+	}
+	if fake.lastTaskID != "" || fake.lastTasklist != "" {
+		t.Errorf("expected no API calls, got task %q in list %q", fake.lastTaskID, fake.lastTasklist)
+	}
+
+	params, _ := json.Marshal(map[string]interface{}{"name": toolListTaskLists})
+	resp := s.handleRequest(context.Background(), JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "tools/call", Params: params})
+	if resp.Result.(map[string]interface{})["isError"] == true {
+		t.Errorf("expected reads to work in read-only mode, got %v", resp.Result)
+	}
+}
+
+// serve
+
+// blockingTasks blocks ListTaskLists until its context is cancelled.
+type blockingTasks struct {
+	*fakeTasks
+	started   chan struct{}
+	cancelled chan struct{}
+}
+
+func (b *blockingTasks) ListTaskLists(ctx context.Context) ([]TaskListItem, error) {
+	close(b.started)
+	<-ctx.Done()
+	close(b.cancelled)
+	return nil, ctx.Err()
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServe_ConcurrentCallsAndCancellation(t *testing.T) {
+	blocking := &blockingTasks{
+		fakeTasks: &fakeTasks{taskItems: []TaskItem{{ID: "t1", Title: "Quick", Status: "needsAction"}}},
+		started:   make(chan struct{}),
+		cancelled: make(chan struct{}),
+	}
+	s := &Server{accounts: []*account{{name: defaultAccountName, tasks: blocking}}, loc: time.UTC}
+
+	in, stdin := io.Pipe()
+	out := &lockedBuffer{}
+	finished := make(chan struct{})
+	go func() {
+		s.serve(context.Background(), in, out)
+		close(finished)
+	}()
+
+	fmt.Fprintln(stdin, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"list_task_lists"}}`)
+	<-blocking.started
+
+	// A second call completes while the first is still blocked
+	fmt.Fprintln(stdin, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"list_tasks"}}`)
+	waitFor(t, "response to request 2", func() bool { return strings.Contains(out.String(), `"id":2`) })
+
+	fmt.Fprintln(stdin, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":1,"reason":"user"}}`)
+	select {
+	case <-blocking.cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected request 1 to be cancelled")
+	}
+
+	stdin.Close()
+	<-finished
+
+	if strings.Contains(out.String(), `"id":1`) {
+		t.Errorf("expected no response for cancelled request, got: %s", out.String())
+	}
+}
+
+func TestServe_StdinCloseCancelsInFlight(t *testing.T) {
+	blocking := &blockingTasks{
+		fakeTasks: &fakeTasks{},
+		started:   make(chan struct{}),
+		cancelled: make(chan struct{}),
+	}
+	s := &Server{accounts: []*account{{name: defaultAccountName, tasks: blocking}}, loc: time.UTC}
+
+	in, stdin := io.Pipe()
+	finished := make(chan struct{})
+	go func() {
+		s.serve(context.Background(), in, &lockedBuffer{})
+		close(finished)
+	}()
+
+	fmt.Fprintln(stdin, `{"jsonrpc":"2.0","id":"a","method":"tools/call","params":{"name":"list_task_lists"}}`)
+	<-blocking.started
+	stdin.Close()
+
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected serve to return after stdin closed")
+	}
+	select {
+	case <-blocking.cancelled:
+	default:
+		t.Error("expected in-flight request to be cancelled")
+	}
+}
+
+func TestServe_NotificationsGetNoResponse(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+	out := &lockedBuffer{}
+
+	input := `{"jsonrpc":"2.0","method":"notifications/initialized"}` + "\n" +
+		`{"jsonrpc":"2.0","id":1,"method":"initialize"}` + "\n"
+	s.serve(context.Background(), strings.NewReader(input), out)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"id":1`) {
+		t.Errorf("expected only the initialize response, got: %s", out.String())
+	}
+}
+
+func TestServe_ResourceReadsDontBlockInput(t *testing.T) {
+	blocking := &blockingTasks{
+		fakeTasks: &fakeTasks{},
+		started:   make(chan struct{}),
+		cancelled: make(chan struct{}),
+	}
+	s := &Server{accounts: []*account{{name: defaultAccountName, tasks: blocking}}, loc: time.UTC}
+
+	in, stdin := io.Pipe()
+	out := &lockedBuffer{}
+	finished := make(chan struct{})
+	go func() {
+		s.serve(context.Background(), in, out)
+		close(finished)
+	}()
+
+	fmt.Fprintln(stdin, `{"jsonrpc":"2.0","id":1,"method":"resources/list"}`)
+	<-blocking.started
+
+	fmt.Fprintln(stdin, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	waitFor(t, "response to request 2", func() bool { return strings.Contains(out.String(), `"id":2`) })
+
+	fmt.Fprintln(stdin, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":1}}`)
+	select {
+	case <-blocking.cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected resources/list to be cancelled")
+	}
+
+	stdin.Close()
+	<-finished
+}
+
+func TestTrackRequest_ReusedID(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+	ctx := withNotifier(context.Background(), s)
+
+	_, done1 := s.trackRequest(ctx, float64(1))
+	ctx2, done2 := s.trackRequest(ctx, float64(1))
+	defer done2()
+
+	// The first request finishing must not untrack the second
+	done1()
+	s.cancelRequest(ctx, json.RawMessage(`{"requestId":1}`))
+	if ctx2.Err() == nil {
+		t.Error("expected the newer request to be cancelled")
+	}
+}
+
+func TestCancelRequest_OtherClient(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+	reqCtx, done := s.trackRequest(withNotifier(context.Background(), &httpSession{}), float64(1))
+	defer done()
+
+	s.cancelRequest(withNotifier(context.Background(), &httpSession{}), json.RawMessage(`{"requestId":1}`))
+	if reqCtx.Err() != nil {
+		t.Error("expected another client's cancellation to be ignored")
+	}
+}
+
+func TestRequestKey_DistinguishesTypes(t *testing.T) {
+	if requestKey(float64(1)) == requestKey("1") {
+		t.Error("expected numeric and string IDs to have different keys")
+	}
+}
+
 // list_task_lists
 
 func TestCallListTaskLists(t *testing.T) {
@@ -144,6 +535,20 @@ func TestCallListTaskLists(t *testing.T) {
 	}
 }
 
+func TestCallListTaskLists_Structured(t *testing.T) {
+	fake := &fakeTasks{
+		taskLists: []TaskListItem{{ID: "list1", Title: "My Tasks"}},
+	}
+	s := newTestServer(fake)
+
+	resp := s.callListTaskLists(context.Background(), float64(1))
+	structured := getStructuredContent(t, resp)
+	lists := structured["task_lists"].([]TaskListItem)
+	if len(lists) != 1 || lists[0].ID != "list1" {
+		t.Errorf("expected task list in structured content, got %v", structured)
+	}
+}
+
 func TestCallListTaskLists_Empty(t *testing.T) {
 	s := newTestServer(&fakeTasks{})
 	resp := s.callListTaskLists(context.Background(), float64(1))
@@ -153,6 +558,110 @@ func TestCallListTaskLists_Empty(t *testing.T) {
 	}
 }
 
+// create_task_list, update_task_list, delete_task_list
+
+func TestCallCreateTaskList(t *testing.T) {
+	fake := &fakeTasks{createdList: &tasks.TaskList{Id: "list-new", Title: "Project"}}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{"title": "Project"})
+	resp := s.callCreateTaskList(context.Background(), float64(1), args)
+
+	if fake.lastTitle != "Project" {
+		t.Errorf("expected title Project, got %q", fake.lastTitle)
+	}
+	text := getResponseText(t, resp)
+	if !strings.Contains(text, "list-new") {
+		t.Errorf("expected new list ID in response, got: %s", text)
+	}
+}
+
+func TestCallCreateTaskList_MissingTitle(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+	args, _ := json.Marshal(map[string]string{})
+	resp := s.callCreateTaskList(context.Background(), float64(1), args)
+	if resp.Error == nil {
+		t.Error("expected error for missing title")
+	}
+}
+
+func TestCallUpdateTaskList(t *testing.T) {
+	fake := &fakeTasks{updatedList: &tasks.TaskList{Id: "list1", Title: "Renamed"}}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{"tasklist_id": "list1", "title": "Renamed"})
+	resp := s.callUpdateTaskList(context.Background(), float64(1), args)
+
+	if fake.lastTasklist != "list1" || fake.lastTitle != "Renamed" {
+		t.Errorf("unexpected rename arguments: %s %s", fake.lastTasklist, fake.lastTitle)
+	}
+	text := getResponseText(t, resp)
+	if !strings.Contains(text, "Renamed") {
+		t.Errorf("expected new title in response, got: %s", text)
+	}
+}
+
+func TestCallUpdateTaskList_MissingTasklistID(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+	args, _ := json.Marshal(map[string]string{"title": "Renamed"})
+	resp := s.callUpdateTaskList(context.Background(), float64(1), args)
+	if resp.Error == nil {
+		t.Error("expected error for missing tasklist_id")
+	}
+}
+
+func TestCallDeleteTaskList_Empty(t *testing.T) {
+	fake := &fakeTasks{}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{"tasklist_id": "list1"})
+	resp := s.callDeleteTaskList(context.Background(), float64(1), args)
+
+	getResponseText(t, resp)
+	if fake.deletedList != "list1" {
+		t.Errorf("expected list1 to be deleted, got %q", fake.deletedList)
+	}
+}
+
+func TestCallDeleteTaskList_NonEmptyRequiresConfirm(t *testing.T) {
+	fake := &fakeTasks{taskItems: []TaskItem{{ID: "t1", Title: "Task"}}}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{"tasklist_id": "list1"})
+	resp := s.callDeleteTaskList(context.Background(), float64(1), args)
+
+	result := resp.Result.(map[string]interface{})
+	if result["isError"] != true {
+		t.Error("expected tool error for non-empty list without confirm")
+	}
+	if fake.deletedList != "" {
+		t.Errorf("expected list not to be deleted, got %q", fake.deletedList)
+	}
+
+	args, _ = json.Marshal(map[string]interface{}{"tasklist_id": "list1", "confirm": true})
+	resp = s.callDeleteTaskList(context.Background(), float64(1), args)
+	getResponseText(t, resp)
+	if fake.deletedList != "list1" {
+		t.Errorf("expected list1 to be deleted with confirm, got %q", fake.deletedList)
+	}
+}
+
+func TestCallDeleteTaskList_HiddenTasksRequireConfirm(t *testing.T) {
+	fake := &fakeTasks{hiddenItems: []TaskItem{{ID: "t1", Title: "Cleared", Status: "completed"}}}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{"tasklist_id": "list1"})
+	resp := s.callDeleteTaskList(context.Background(), float64(1), args)
+
+	result := resp.Result.(map[string]interface{})
+	if result["isError"] != true {
+		t.Error("expected tool error for a list holding only hidden tasks without confirm")
+	}
+	if fake.deletedList != "" {
+		t.Errorf("expected list not to be deleted, got %q", fake.deletedList)
+	}
+}
+
 // list_tasks
 
 func TestCallListTasks_DefaultTasklist(t *testing.T) {
@@ -198,7 +707,7 @@ func TestCallListTasks_WithDueTime(t *testing.T) {
 			{ID: "t1", Title: "Task", Status: "needsAction", Due: "2026-03-01T10:30:00+04:00"},
 		},
 	}
-	s := &Server{tasks: fake, loc: loc}
+	s := &Server{accounts: []*account{{name: defaultAccountName, tasks: fake}}, loc: loc}
 
 	resp := s.callListTasks(context.Background(), float64(1), nil)
 	text := getResponseText(t, resp)
@@ -231,6 +740,255 @@ func TestCallListTasks_Empty(t *testing.T) {
 	}
 }
 
+func TestCallListTasks_StructuredSurvivesNewlines(t *testing.T) {
+	fake := &fakeTasks{
+		taskItems:     []TaskItem{{ID: "t1", Title: "Line one\nLine two", Status: "needsAction"}},
+		nextPageToken: "page-2",
+	}
+	s := newTestServer(fake)
+
+	resp := s.callListTasks(context.Background(), float64(1), nil)
+	data, err := json.Marshal(getStructuredContent(t, resp))
+	if err != nil {
+		t.Fatalf("failed to marshal structured content: %v", err)
+	}
+
+	var decoded struct {
+		Tasks         []TaskItem `json:"tasks"`
+		NextPageToken string     `json:"next_page_token"`
+	}
+	json.Unmarshal(data, &decoded)
+	if len(decoded.Tasks) != 1 || decoded.Tasks[0].Title != "Line one\nLine two" || decoded.NextPageToken != "page-2" {
+		t.Errorf("unexpected structured content: %s", data)
+	}
+}
+
+func TestCallListTasks_NextPageToken(t *testing.T) {
+	fake := &fakeTasks{
+		taskItems:     []TaskItem{{ID: "t1", Title: "First", Status: "needsAction"}},
+		nextPageToken: "page-2",
+	}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]interface{}{"limit": 1})
+	resp := s.callListTasks(context.Background(), float64(1), args)
+	if fake.lastLimit != 1 {
+		t.Errorf("expected limit 1, got %d", fake.lastLimit)
+	}
+	text := getResponseText(t, resp)
+	if !strings.Contains(text, "page_token: page-2") {
+		t.Errorf("expected next page token in response, got: %s", text)
+	}
+}
+
+func TestCallListTasks_LastPage(t *testing.T) {
+	fake := &fakeTasks{
+		taskItems: []TaskItem{{ID: "t2", Title: "Second", Status: "needsAction"}},
+	}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]interface{}{"page_token": "page-2"})
+	resp := s.callListTasks(context.Background(), float64(1), args)
+	if fake.lastPageToken != "page-2" {
+		t.Errorf("expected page token page-2, got %q", fake.lastPageToken)
+	}
+	text := getResponseText(t, resp)
+	if !strings.Contains(text, "No more tasks") {
+		t.Errorf("expected last page notice in response, got: %s", text)
+	}
+}
+
+func TestCallListTasks_NegativeLimit(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+	args, _ := json.Marshal(map[string]interface{}{"limit": -1})
+	resp := s.callListTasks(context.Background(), float64(1), args)
+	if resp.Error == nil {
+		t.Error("expected error for negative limit")
+	}
+}
+
+func TestCallListTasks_InvalidLimit(t *testing.T) {
+	fake := &fakeTasks{}
+	s := newTestServer(fake)
+	resp := s.callListTasks(context.Background(), float64(1), json.RawMessage(`{"limit":"10"}`))
+	if resp.Error == nil || resp.Error.Message != "Invalid arguments" {
+		t.Errorf("expected invalid arguments error, got %+v", resp.Error)
+	}
+	if fake.lastTasklist != "" {
+		t.Error("expected no tasks to be listed")
+	}
+}
+
+func TestCallListTasks_SubtaskTree(t *testing.T) {
+	fake := &fakeTasks{
+		taskItems: []TaskItem{
+			{ID: "c2", Title: "Child two", Status: "needsAction", Parent: "p1", Position: "00000000000000000001"},
+			{ID: "p2", Title: "Parent two", Status: "needsAction", Position: "00000000000000000001"},
+			{ID: "c1", Title: "Child one", Status: "needsAction", Parent: "p1", Position: "00000000000000000000"},
+			{ID: "p1", Title: "Parent one", Status: "needsAction", Position: "00000000000000000000"},
+		},
+	}
+	s := newTestServer(fake)
+
+	resp := s.callListTasks(context.Background(), float64(1), nil)
+	text := getResponseText(t, resp)
+
+	order := []string{"[ ] Parent one", "    [ ] Child one", "    [ ] Child two", "[ ] Parent two"}
+	last := -1
+	for _, line := range order {
+		idx := strings.Index(text, line)
+		if idx <= last {
+			t.Fatalf("expected %q after previous entries, got:\n%s", line, text)
+		}
+		last = idx
+	}
+}
+
+func TestCallListTasks_OrphanSubtaskAtTopLevel(t *testing.T) {
+	fake := &fakeTasks{
+		taskItems: []TaskItem{
+			{ID: "c1", Title: "Orphan", Status: "needsAction", Parent: "missing"},
+		},
+	}
+	s := newTestServer(fake)
+
+	resp := s.callListTasks(context.Background(), float64(1), nil)
+	text := getResponseText(t, resp)
+	if !strings.HasPrefix(text, "Found 1 task(s):\n\n[ ] Orphan") {
+		t.Errorf("expected orphaned subtask at top level, got: %s", text)
+	}
+}
+
+// search_tasks
+
+func TestCallSearchTasks_GroupsByList(t *testing.T) {
+	fake := &fakeTasks{
+		taskLists: []TaskListItem{{ID: "home", Title: "Home"}, {ID: "work", Title: "Work"}, {ID: "misc", Title: "Misc"}},
+		tasksByList: map[string][]TaskItem{
+			"home": {{ID: "h1", Title: "Pay invoice for plumber", Status: "needsAction"}},
+			"work": {
+				{ID: "w1", Title: "Send invoice", Notes: "to ACME", Status: "needsAction"},
+				{ID: "w2", Title: "Review PR", Status: "needsAction"},
+			},
+			"misc": {{ID: "m1", Title: "Walk", Status: "needsAction"}},
+		},
+	}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{"query": "Invoice"})
+	resp := s.callSearchTasks(context.Background(), float64(1), args)
+	text := getResponseText(t, resp)
+
+	if !strings.HasPrefix(text, "Found 2 matching task(s) in 2 list(s)") {
+		t.Errorf("expected match summary, got: %s", text)
+	}
+	for _, want := range []string{"== Home (ID: home) ==", "== Work (ID: work) ==", "ID: h1", "ID: w1"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in response, got: %s", want, text)
+		}
+	}
+	if strings.Contains(text, "Misc") || strings.Contains(text, "w2") {
+		t.Errorf("expected non-matching tasks to be excluded, got: %s", text)
+	}
+	if fake.lastFilter.ShowCompleted {
+		t.Error("expected completed tasks to be excluded by default")
+	}
+}
+
+func TestCallSearchTasks_MatchesNotesAndAllTerms(t *testing.T) {
+	fake := &fakeTasks{
+		taskLists: []TaskListItem{{ID: "work", Title: "Work"}},
+		taskItems: []TaskItem{
+			{ID: "w1", Title: "Send invoice", Notes: "to ACME", Status: "needsAction"},
+			{ID: "w2", Title: "Send invoice", Notes: "to Globex", Status: "needsAction"},
+		},
+	}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{"query": "invoice acme"})
+	resp := s.callSearchTasks(context.Background(), float64(1), args)
+	text := getResponseText(t, resp)
+	if !strings.Contains(text, "w1") || strings.Contains(text, "w2") {
+		t.Errorf("expected only w1 to match, got: %s", text)
+	}
+}
+
+func TestCallSearchTasks_StatusAndDueFilter(t *testing.T) {
+	fake := &fakeTasks{
+		taskLists: []TaskListItem{{ID: "work", Title: "Work"}},
+		taskItems: []TaskItem{
+			{ID: "w1", Title: "Open", Status: "needsAction"},
+			{ID: "w2", Title: "Done", Status: "completed"},
+		},
+	}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{"status": "completed", "due_after": "2026-03-01", "due_before": "2026-03-31"})
+	resp := s.callSearchTasks(context.Background(), float64(1), args)
+	text := getResponseText(t, resp)
+
+	if !fake.lastFilter.ShowCompleted || !fake.lastFilter.ShowHidden {
+		t.Error("expected completed and hidden tasks to be requested")
+	}
+	if fake.lastFilter.DueMin != "2026-03-01T00:00:00Z" || fake.lastFilter.DueMax != "2026-04-01T00:00:00Z" {
+		t.Errorf("unexpected due range: %+v", fake.lastFilter)
+	}
+	if !strings.Contains(text, "w2") || strings.Contains(text, "w1") {
+		t.Errorf("expected only completed task, got: %s", text)
+	}
+}
+
+func TestCallSearchTasks_DueRangeNegativeOffset(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	fake := &fakeTasks{taskLists: []TaskListItem{{ID: "work", Title: "Work"}}}
+	s := newTestServer(fake)
+	s.loc = loc
+
+	args, _ := json.Marshal(map[string]string{"due_after": "2026-03-01", "due_before": "2026-03-01"})
+	s.callSearchTasks(context.Background(), float64(1), args)
+
+	// A task due 2026-03-01 is stored as 2026-03-01T00:00:00Z and must fall in range
+	if fake.lastFilter.DueMin != "2026-03-01T00:00:00Z" || fake.lastFilter.DueMax != "2026-03-02T00:00:00Z" {
+		t.Errorf("expected UTC date bounds, got %+v", fake.lastFilter)
+	}
+}
+
+func TestCallSearchTasks_Subset(t *testing.T) {
+	fake := &fakeTasks{
+		taskLists: []TaskListItem{{ID: "home", Title: "Home"}, {ID: "work", Title: "Work"}},
+	}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]interface{}{"tasklists": []string{"work"}, "tasklist_ids": []string{"home"}})
+	resp := s.callSearchTasks(context.Background(), float64(1), args)
+	text := getResponseText(t, resp)
+
+	if len(fake.searchedLists) != 2 || fake.searchedLists[0] != "home" || fake.searchedLists[1] != "work" {
+		t.Errorf("expected home and work to be searched, got %v", fake.searchedLists)
+	}
+	if text != "No matching tasks found." {
+		t.Errorf("expected no matches, got %q", text)
+	}
+}
+
+func TestCallSearchTasks_InvalidArguments(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+	for _, args := range []map[string]string{
+		{"status": "bogus"},
+		{"due_after": "tomorrow"},
+		{"due_before": "2026-13-01"},
+	} {
+		raw, _ := json.Marshal(args)
+		resp := s.callSearchTasks(context.Background(), float64(1), raw)
+		if resp.Error == nil {
+			t.Errorf("expected param error for %v", args)
+		}
+	}
+}
+
 // create_task
 
 func TestCallCreateTask(t *testing.T) {
@@ -251,6 +1009,38 @@ func TestCallCreateTask(t *testing.T) {
 	}
 }
 
+func TestCallCreateTask_Structured(t *testing.T) {
+	fake := &fakeTasks{
+		created: &tasks.Task{Id: "new-1", Title: "New task", Status: "needsAction"},
+	}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{"title": "New task"})
+	resp := s.callCreateTask(context.Background(), float64(1), args)
+	task := getStructuredContent(t, resp)["task"].(TaskItem)
+	if task.ID != "new-1" || task.Status != "needsAction" {
+		t.Errorf("unexpected structured task: %+v", task)
+	}
+}
+
+func TestCallCreateTask_WithParent(t *testing.T) {
+	fake := &fakeTasks{
+		created: &tasks.Task{Id: "sub-1", Title: "Subtask", Parent: "p1"},
+	}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{"title": "Subtask", "parent_id": "p1"})
+	resp := s.callCreateTask(context.Background(), float64(1), args)
+
+	if fake.lastParent != "p1" {
+		t.Errorf("expected parent p1, got %q", fake.lastParent)
+	}
+	text := getResponseText(t, resp)
+	if !strings.Contains(text, "Parent: p1") {
+		t.Errorf("expected parent in response, got: %s", text)
+	}
+}
+
 func TestCallCreateTask_MissingTitle(t *testing.T) {
 	s := newTestServer(&fakeTasks{})
 	args, _ := json.Marshal(map[string]string{"notes": "no title"})
@@ -279,6 +1069,33 @@ func TestCallUpdateTask(t *testing.T) {
 	}
 }
 
+func TestCallUpdateTask_ETagConflict(t *testing.T) {
+	fake := &fakeTasks{err: &ConflictError{
+		Current:  &tasks.Task{Id: "t1", Title: "Renamed on phone", Status: "needsAction", Etag: `"v2"`},
+		Proposed: &tasks.Task{Id: "t1", Title: "Agent title", Status: "needsAction", Etag: `"v2"`},
+	}}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]interface{}{"task_id": "t1", "title": "Agent title", "etag": `"v1"`})
+	resp := s.callUpdateTask(context.Background(), float64(1), args)
+
+	if fake.lastUpdates.ETag != `"v1"` {
+		t.Errorf("expected etag to be passed on, got %q", fake.lastUpdates.ETag)
+	}
+	text, isErr := toolResult(t, resp)
+	if !isErr {
+		t.Fatalf("expected tool error, got %q", text)
+	}
+	current := text[strings.Index(text, "Current version:"):strings.Index(text, "With your changes:")]
+	proposed := text[strings.Index(text, "With your changes:"):]
+	if !strings.Contains(current, "Renamed on phone") || !strings.Contains(proposed, "Agent title") {
+		t.Errorf("expected both versions in error, got:\n%s", text)
+	}
+	if !strings.Contains(text, `retry with etag "\"v2\""`) {
+		t.Errorf("expected current etag to retry with, got:\n%s", text)
+	}
+}
+
 func TestCallUpdateTask_MissingTaskID(t *testing.T) {
 	s := newTestServer(&fakeTasks{})
 	args, _ := json.Marshal(map[string]string{"title": "No ID"})
@@ -319,6 +1136,82 @@ func TestCallCompleteTask_MissingTaskID(t *testing.T) {
 	}
 }
 
+// reopen_task
+
+func TestCallReopenTask(t *testing.T) {
+	completed := "2026-03-14T18:30:00.000Z"
+	fake := &fakeTasks{
+		task:    &tasks.Task{Id: "t1", Title: "Oops", Status: "completed", Completed: &completed},
+		updated: &tasks.Task{Id: "t1", Title: "Oops", Status: "needsAction"},
+	}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{"task_id": "t1", "tasklist_id": "list1"})
+	resp := s.callReopenTask(context.Background(), float64(1), args)
+
+	text, isErr := toolResult(t, resp)
+	if isErr {
+		t.Fatalf("unexpected error: %s", text)
+	}
+	if fake.lastUpdates.Status == nil || *fake.lastUpdates.Status != "needsAction" {
+		t.Errorf("expected status needsAction to be set, got %+v", fake.lastUpdates)
+	}
+	if !strings.Contains(text, "Task reopened!") || !strings.Contains(text, "Cleared completion time: 2026-03-14 18:30") {
+		t.Errorf("expected the cleared completion time, got:\n%s", text)
+	}
+	structured := resp.Result.(map[string]interface{})["structuredContent"].(map[string]interface{})
+	if structured["previously_completed"] != completed {
+		t.Errorf("expected previously_completed, got %v", structured)
+	}
+}
+
+func TestCallReopenTask_NotCompleted(t *testing.T) {
+	fake := &fakeTasks{
+		task:    &tasks.Task{Id: "t1", Title: "Open", Status: "needsAction"},
+		updated: &tasks.Task{Id: "t1", Title: "Open", Status: "needsAction"},
+	}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{"task_id": "t1"})
+	text, _ := toolResult(t, s.callReopenTask(context.Background(), float64(1), args))
+	if !strings.Contains(text, "The task was not completed.") {
+		t.Errorf("expected note that nothing was cleared, got:\n%s", text)
+	}
+}
+
+func TestCallReopenTask_MissingTaskID(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+	args, _ := json.Marshal(map[string]string{})
+	resp := s.callReopenTask(context.Background(), float64(1), args)
+	if resp.Error == nil {
+		t.Error("expected error for missing task_id")
+	}
+}
+
+func TestCallUpdateTask_Status(t *testing.T) {
+	completed := "2026-03-14T00:00:00.000Z"
+	fake := &fakeTasks{
+		task:    &tasks.Task{Id: "t1", Title: "Oops", Status: "completed", Completed: &completed},
+		updated: &tasks.Task{Id: "t1", Title: "Oops", Status: "needsAction"},
+	}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{"task_id": "t1", "status": "needsAction"})
+	text, isErr := toolResult(t, s.callUpdateTask(context.Background(), float64(1), args))
+	if isErr || !strings.Contains(text, "Cleared completion time: 2026-03-14") {
+		t.Errorf("expected the cleared completion time, got:\n%s", text)
+	}
+	if fake.lastUpdates.Status == nil || *fake.lastUpdates.Status != "needsAction" {
+		t.Errorf("expected status to be passed on, got %+v", fake.lastUpdates)
+	}
+
+	args, _ = json.Marshal(map[string]string{"task_id": "t1", "status": "done"})
+	resp := s.callUpdateTask(context.Background(), float64(1), args)
+	if resp.Error == nil || resp.Error.Code != -32602 {
+		t.Errorf("expected invalid params for unknown status, got %+v", resp)
+	}
+}
+
 // delete_task
 
 func TestCallDeleteTask(t *testing.T) {
@@ -345,6 +1238,98 @@ func TestCallDeleteTask_MissingTaskID(t *testing.T) {
 	}
 }
 
+// move_task
+
+func TestCallMoveTask(t *testing.T) {
+	fake := &fakeTasks{
+		moved: &tasks.Task{Id: "t1", Title: "Moved", Parent: "p1", Position: "00000000000000000001"},
+	}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{
+		"task_id":                 "t1",
+		"parent_id":               "p1",
+		"previous_id":             "t0",
+		"destination_tasklist_id": "work",
+	})
+	resp := s.callMoveTask(context.Background(), float64(1), args)
+
+	if fake.lastTaskID != "t1" || fake.lastParent != "p1" || fake.lastPrevious != "t0" || fake.lastDest != "work" {
+		t.Errorf("unexpected move arguments: task=%s parent=%s previous=%s dest=%s",
+			fake.lastTaskID, fake.lastParent, fake.lastPrevious, fake.lastDest)
+	}
+	text := getResponseText(t, resp)
+	if !strings.Contains(text, "List: work") || !strings.Contains(text, "Parent: p1") {
+		t.Errorf("expected new location in response, got: %s", text)
+	}
+}
+
+func TestCallMoveTask_TopLevel(t *testing.T) {
+	fake := &fakeTasks{
+		moved: &tasks.Task{Id: "t1", Title: "Moved", Position: "00000000000000000000"},
+	}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{"task_id": "t1"})
+	resp := s.callMoveTask(context.Background(), float64(1), args)
+	text := getResponseText(t, resp)
+	if !strings.Contains(text, "List: @default") || !strings.Contains(text, "Parent: (top level)") {
+		t.Errorf("expected top level location in response, got: %s", text)
+	}
+}
+
+func TestCallMoveTask_MissingTaskID(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+	args, _ := json.Marshal(map[string]string{})
+	resp := s.callMoveTask(context.Background(), float64(1), args)
+	if resp.Error == nil {
+		t.Error("expected error for missing task_id")
+	}
+}
+
+// clear_completed
+
+func TestCallClearCompleted(t *testing.T) {
+	fake := &fakeTasks{
+		taskItems: []TaskItem{
+			{ID: "t1", Title: "Done", Status: "completed"},
+			{ID: "t2", Title: "Also done", Status: "completed"},
+			{ID: "t3", Title: "Open", Status: "needsAction"},
+		},
+	}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{"tasklist_id": "list1"})
+	resp := s.callClearCompleted(context.Background(), float64(1), args)
+
+	if !fake.lastCompleted {
+		t.Error("expected pre-listing to include completed tasks")
+	}
+	if fake.clearedList != "list1" {
+		t.Errorf("expected list1 to be cleared, got %q", fake.clearedList)
+	}
+	text := getResponseText(t, resp)
+	if text != "Cleared 2 completed task(s)." {
+		t.Errorf("expected cleared count in response, got %q", text)
+	}
+}
+
+func TestCallClearCompleted_NothingToClear(t *testing.T) {
+	fake := &fakeTasks{
+		taskItems: []TaskItem{{ID: "t1", Title: "Open", Status: "needsAction"}},
+	}
+	s := newTestServer(fake)
+
+	resp := s.callClearCompleted(context.Background(), float64(1), nil)
+	if fake.clearedList != "" {
+		t.Errorf("expected no clear call, got %q", fake.clearedList)
+	}
+	text := getResponseText(t, resp)
+	if text != "No completed tasks to clear." {
+		t.Errorf("expected nothing to clear, got %q", text)
+	}
+}
+
 // helpers
 
 func TestSuccessResponse(t *testing.T) {
@@ -365,6 +1350,19 @@ func TestErrorResponse(t *testing.T) {
 	}
 }
 
+func getStructuredContent(t *testing.T, resp *JSONRPCResponse) map[string]interface{} {
+	t.Helper()
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %v", resp.Error)
+	}
+	result := resp.Result.(map[string]interface{})
+	structured, ok := result["structuredContent"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected structuredContent in result, got %v", result)
+	}
+	return structured
+}
+
 func getResponseText(t *testing.T, resp *JSONRPCResponse) string {
 	t.Helper()
 	if resp.Error != nil {
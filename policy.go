@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// policy is the file named by GOOGLE_TASKS_POLICY. It switches tools on or
+// off and restricts which task lists each tool may touch.
+type policy struct {
+	// Allow, when set, is the only tools that may be called; Deny disables tools
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+
+	// Lists restricts every tool to task lists matching these patterns
+	Lists []string `json:"lists"`
+
+	// Tools overrides Lists for individual tools
+	Tools map[string]toolPolicy `json:"tools"`
+}
+
+type toolPolicy struct {
+	Lists []string `json:"lists"`
+}
+
+// loadPolicy reads a policy file and checks that it only names known tools.
+func loadPolicy(file string) (*policy, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read policy file: %v", err)
+	}
+
+	p := &policy{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("unable to parse policy file: %v", err)
+	}
+
+	known := make(map[string]bool)
+	for _, tool := range toolDefinitions() {
+		known[tool["name"].(string)] = true
+	}
+	names := append(append([]string{}, p.Allow...), p.Deny...)
+	patterns := append([]string{}, p.Lists...)
+	for name, tp := range p.Tools {
+		names = append(names, name)
+		patterns = append(patterns, tp.Lists...)
+	}
+
+	for _, name := range names {
+		if !known[name] {
+			return nil, fmt.Errorf("policy file names unknown tool %q", name)
+		}
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("policy file has invalid task list pattern %q: %v", pattern, err)
+		}
+	}
+	return p, nil
+}
+
+// allowsTool reports whether a tool may be called.
+func (p *policy) allowsTool(name string) bool {
+	if p == nil {
+		return true
+	}
+	if slices.Contains(p.Deny, name) {
+		return false
+	}
+	return len(p.Allow) == 0 || slices.Contains(p.Allow, name)
+}
+
+// listPatterns returns the task list patterns a tool is restricted to, or nil
+// if it may touch any list.
+func (p *policy) listPatterns(tool string) []string {
+	if p == nil {
+		return nil
+	}
+	if tp, ok := p.Tools[tool]; ok && tp.Lists != nil {
+		return tp.Lists
+	}
+	return p.Lists
+}
+
+// allowsList reports whether a tool may touch a task list. A pattern matches
+// the list's ID exactly, or its title as a case-insensitive glob.
+func (p *policy) allowsList(tool string, l TaskListItem) bool {
+	patterns := p.listPatterns(tool)
+	if patterns == nil {
+		return true
+	}
+	for _, pattern := range patterns {
+		if pattern == l.ID {
+			return true
+		}
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(l.Title)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filterLists returns the task lists a tool may touch.
+func (p *policy) filterLists(tool string, lists []TaskListItem) []TaskListItem {
+	if p.listPatterns(tool) == nil {
+		return lists
+	}
+	allowed := make([]TaskListItem, 0, len(lists))
+	for _, l := range lists {
+		if p.allowsList(tool, l) {
+			allowed = append(allowed, l)
+		}
+	}
+	return allowed
+}
+
+// checkLists reports an error if a tool call names a task list its policy
+// keeps it away from. Tools that cover every list when none is named filter
+// their results with filterLists instead.
+func (s *Server) checkLists(ctx context.Context, tool string, args json.RawMessage) error {
+	if s.policy.listPatterns(tool) == nil {
+		return nil
+	}
+
+	var input struct {
+		TasklistID            string   `json:"tasklist_id"`
+		Tasklist              string   `json:"tasklist"`
+		DestinationTasklistID string   `json:"destination_tasklist_id"`
+		DestinationTasklist   string   `json:"destination_tasklist"`
+		TasklistIDs           []string `json:"tasklist_ids"`
+		Tasklists             []string `json:"tasklists"`
+		Title                 string   `json:"title"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &input); err != nil {
+			// The tool handler reports malformed arguments before touching anything
+			return nil
+		}
+	}
+
+	// Each ref is a tasklist_id and tasklist name pair, as resolveTasklist takes
+	var refs [][2]string
+	switch tool {
+	case toolListTaskLists, toolCreateTaskList, toolBatch:
+		// batch checks each of its operations as the tool it runs
+	case toolSearchTasks:
+		for _, listID := range input.TasklistIDs {
+			refs = append(refs, [2]string{listID, ""})
+		}
+		for _, name := range input.Tasklists {
+			refs = append(refs, [2]string{"", name})
+		}
+	case toolMoveTask:
+		refs = append(refs, [2]string{input.TasklistID, input.Tasklist})
+		if input.DestinationTasklistID != "" || input.DestinationTasklist != "" {
+			refs = append(refs, [2]string{input.DestinationTasklistID, input.DestinationTasklist})
+		}
+	default:
+		refs = append(refs, [2]string{input.TasklistID, input.Tasklist})
+	}
+
+	// A new list doesn't exist yet, so only its title can match
+	var targets []TaskListItem
+	if tool == toolCreateTaskList {
+		targets = append(targets, TaskListItem{Title: input.Title})
+	}
+	for _, ref := range refs {
+		l, err := s.policyTarget(ctx, tool, ref[0], ref[1])
+		if err != nil {
+			return err
+		}
+		targets = append(targets, l)
+	}
+
+	for _, l := range targets {
+		if !s.policy.allowsList(tool, l) {
+			return fmt.Errorf("%s may not touch task list %s under the server's policy (allowed: %s)", tool, describeTaskLists([]TaskListItem{l}), strings.Join(s.policy.listPatterns(tool), ", "))
+		}
+	}
+	return nil
+}
+
+// policyTarget resolves a task list argument to the list it refers to, so
+// that patterns can match its title. It resolves names as strictly as the
+// tool itself will.
+func (s *Server) policyTarget(ctx context.Context, tool, tasklistID, name string) (TaskListItem, error) {
+	resolve := s.resolveTasklist
+	if mutatingTools[tool] {
+		resolve = s.resolveTasklistExact
+	}
+	listID, err := resolve(ctx, tasklistID, name)
+	if err != nil {
+		return TaskListItem{}, err
+	}
+	if listID == defaultTasklistID {
+		return s.defaultTaskList(ctx)
+	}
+	lists, err := s.cachedTaskLists(ctx, false)
+	if err != nil {
+		return TaskListItem{}, err
+	}
+
+	for _, l := range lists {
+		if l.ID == listID {
+			return l, nil
+		}
+	}
+	return TaskListItem{ID: listID}, nil
+}
+
+// readableList resolves the task list a resource or prompt reads, failing if
+// the policy keeps it out of reach. Resources and prompts aren't tools, so
+// only the global lists apply to them.
+func (s *Server) readableList(ctx context.Context, tasklistID, name string) (TaskListItem, error) {
+	l, err := s.policyTarget(ctx, "", tasklistID, name)
+	if err != nil {
+		return TaskListItem{}, err
+	}
+	if !s.policy.allowsList("", l) {
+		return TaskListItem{}, fmt.Errorf("task list %s is outside the server's policy (allowed: %s)", describeTaskLists([]TaskListItem{l}), strings.Join(s.policy.listPatterns(""), ", "))
+	}
+	return l, nil
+}
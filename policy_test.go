@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/tasks/v1"
+)
+
+func newPolicyServer(fake *fakeTasks, p *policy) *Server {
+	s := newTestServer(fake)
+	s.policy = p
+	return s
+}
+
+// toolResult returns the text of a tool call result and whether it is an error.
+func toolResult(t *testing.T, resp *JSONRPCResponse) (string, bool) {
+	t.Helper()
+	if resp.Error != nil {
+		t.Fatalf("unexpected JSON-RPC error: %+v", resp.Error)
+	}
+	result := resp.Result.(map[string]interface{})
+	return result["content"].([]map[string]string)[0]["text"], result["isError"] == true
+}
+
+var policyLists = []TaskListItem{
+	{ID: "inbox", Title: "Inbox"},
+	{ID: "agent1", Title: "Agent scratch"},
+	{ID: "agent2", Title: "Agent plans"},
+	{ID: "private", Title: "Private"},
+}
+
+func TestLoadPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	os.WriteFile(path, []byte(`{
+		"deny": ["delete_task_list"],
+		"lists": ["Agent *", "inbox"],
+		"tools": {"delete_task": {"lists": ["agent1"]}}
+	}`), 0600)
+
+	p, err := loadPolicy(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.allowsTool(toolDeleteTaskList) || !p.allowsTool(toolDeleteTask) {
+		t.Errorf("unexpected tool permissions: %+v", p)
+	}
+	if strings.Join(p.listPatterns(toolDeleteTask), ",") != "agent1" || strings.Join(p.listPatterns(toolCreateTask), ",") != "Agent *,inbox" {
+		t.Errorf("unexpected list patterns: %+v", p)
+	}
+}
+
+func TestLoadPolicy_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"malformed":         `{"deny": "create_task"}`,
+		"unknown allow":     `{"allow": ["list_tasks", "drop_everything"]}`,
+		"unknown deny":      `{"deny": ["delete_tasks"]}`,
+		"unknown tool key":  `{"tools": {"delete": {"lists": ["Inbox"]}}}`,
+		"bad list pattern":  `{"lists": ["[Inbox"]}`,
+		"bad tool patterns": `{"tools": {"delete_task": {"lists": ["Agent [a-"]}}}`,
+	}
+
+	for name, content := range tests {
+		path := filepath.Join(t.TempDir(), "policy.json")
+		os.WriteFile(path, []byte(content), 0600)
+		if _, err := loadPolicy(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestPolicy_AllowsTool(t *testing.T) {
+	var none *policy
+	if !none.allowsTool(toolDeleteTask) {
+		t.Error("expected no policy to allow everything")
+	}
+
+	p := &policy{Allow: []string{toolListTasks, toolCreateTask}, Deny: []string{toolCreateTask}}
+	for tool, want := range map[string]bool{toolListTasks: true, toolCreateTask: false, toolDeleteTask: false} {
+		if got := p.allowsTool(tool); got != want {
+			t.Errorf("%s: expected %v, got %v", tool, want, got)
+		}
+	}
+}
+
+func TestHandleToolsList_Policy(t *testing.T) {
+	s := newPolicyServer(&fakeTasks{}, &policy{
+		Deny:  []string{toolDeleteTaskList, toolClearCompleted},
+		Tools: map[string]toolPolicy{toolDeleteTask: {Lists: []string{"Agent *"}}},
+	})
+	resp := callTool(s, toolListAccounts, nil)
+	if _, isErr := toolResult(t, resp); isErr {
+		t.Fatal("expected list_accounts to be allowed")
+	}
+
+	resp = s.handleToolsList(JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "tools/list"})
+	tools := resp.Result.(map[string]interface{})["tools"].([]map[string]interface{})
+
+	descriptions := make(map[string]string)
+	for _, tool := range tools {
+		descriptions[tool["name"].(string)] = tool["description"].(string)
+	}
+	if _, ok := descriptions[toolDeleteTaskList]; ok {
+		t.Error("expected denied delete_task_list to be hidden")
+	}
+	if _, ok := descriptions[toolClearCompleted]; ok {
+		t.Error("expected denied clear_completed to be hidden")
+	}
+	if !strings.Contains(descriptions[toolDeleteTask], "Restricted by policy to task lists matching: Agent *") {
+		t.Errorf("expected restriction in delete_task description, got %q", descriptions[toolDeleteTask])
+	}
+	if strings.Contains(descriptions[toolCreateTask], "Restricted") {
+		t.Errorf("expected unrestricted create_task description, got %q", descriptions[toolCreateTask])
+	}
+}
+
+func TestCallTool_PolicyDeniesTool(t *testing.T) {
+	fake := &fakeTasks{taskLists: policyLists}
+	s := newPolicyServer(fake, &policy{Allow: []string{toolListTasks}})
+
+	text, isErr := toolResult(t, callTool(s, toolDeleteTask, map[string]interface{}{"task_id": "t1"}))
+	if !isErr || !strings.Contains(text, "delete_task is disabled by the server's policy") {
+		t.Errorf("expected policy error, got %q", text)
+	}
+	if fake.lastTaskID != "" {
+		t.Errorf("expected no API call, got task %q", fake.lastTaskID)
+	}
+}
+
+func TestCallTool_PolicyRestrictsLists(t *testing.T) {
+	s := newPolicyServer(&fakeTasks{}, &policy{
+		Lists: []string{"Agent *", "inbox"},
+		Tools: map[string]toolPolicy{toolDeleteTask: {Lists: []string{"agent1"}}},
+	})
+
+	tests := []struct {
+		name    string
+		tool    string
+		args    map[string]interface{}
+		allowed bool
+	}{
+		{"list by ID", toolListTasks, map[string]interface{}{"tasklist_id": "agent2"}, true},
+		{"list by name", toolListTasks, map[string]interface{}{"tasklist": "private"}, false},
+		{"default list", toolListTasks, map[string]interface{}{}, true},
+		{"unknown ID", toolListTasks, map[string]interface{}{"tasklist_id": "elsewhere"}, false},
+		{"tool override", toolDeleteTask, map[string]interface{}{"tasklist_id": "agent2", "task_id": "t1"}, false},
+		{"tool override by ID", toolDeleteTask, map[string]interface{}{"tasklist_id": "agent1", "task_id": "t1"}, true},
+		{"move destination", toolMoveTask, map[string]interface{}{"tasklist": "Inbox", "task_id": "t1", "destination_tasklist": "Private"}, false},
+		{"move within", toolMoveTask, map[string]interface{}{"tasklist": "Inbox", "task_id": "t1", "destination_tasklist_id": "agent1"}, true},
+		{"search subset", toolSearchTasks, map[string]interface{}{"tasklist_ids": []string{"inbox", "private"}}, false},
+		{"create list", toolCreateTaskList, map[string]interface{}{"title": "Agent notes"}, true},
+		{"create other list", toolCreateTaskList, map[string]interface{}{"title": "Groceries"}, false},
+	}
+
+	for _, tt := range tests {
+		fake := &fakeTasks{
+			taskLists:   policyLists,
+			createdList: &tasks.TaskList{Id: "agent3", Title: "Agent notes"},
+			created:     &tasks.Task{Id: "t2", Title: "New"},
+			moved:       &tasks.Task{Id: "t1", Title: "Moved"},
+		}
+		s.accounts[0] = &account{name: defaultAccountName, tasks: fake}
+
+		text, isErr := toolResult(t, callTool(s, tt.tool, tt.args))
+		denied := isErr && strings.Contains(text, "under the server's policy")
+		if denied == tt.allowed {
+			t.Errorf("%s: expected allowed %v, got %q", tt.name, tt.allowed, text)
+		}
+		if denied && (fake.lastTaskID != "" || fake.lastTasklist != "" || fake.lastTitle != "") {
+			t.Errorf("%s: expected no API call after denial", tt.name)
+		}
+	}
+}
+
+func TestCallTool_PolicyFiltersAllLists(t *testing.T) {
+	fake := &fakeTasks{
+		taskLists: policyLists,
+		tasksByList: map[string][]TaskItem{
+			"inbox":   {{ID: "t1", Title: "Reply to invoice", Status: "needsAction"}},
+			"private": {{ID: "t2", Title: "Secret invoice", Status: "needsAction"}},
+		},
+	}
+	s := newPolicyServer(fake, &policy{Lists: []string{"Inbox"}})
+
+	text, _ := toolResult(t, callTool(s, toolListTaskLists, nil))
+	if !strings.Contains(text, "Inbox") || strings.Contains(text, "Private") {
+		t.Errorf("expected only allowed lists, got:\n%s", text)
+	}
+
+	text, _ = toolResult(t, callTool(s, toolSearchTasks, map[string]interface{}{"query": "invoice"}))
+	if !strings.Contains(text, "Reply to invoice") || strings.Contains(text, "Secret") {
+		t.Errorf("expected search to skip denied lists, got:\n%s", text)
+	}
+
+	// The cached lists must not have been filtered in place
+	if len(s.accounts[0].lists) != len(policyLists) {
+		t.Errorf("expected cache to keep every list, got %v", s.accounts[0].lists)
+	}
+}
+
+func TestPolicy_DefaultListResolvedExplicitly(t *testing.T) {
+	// The default list need not be the first one Google lists
+	fake := &fakeTasks{taskLists: policyLists, defaultList: &tasks.TaskList{Id: "private", Title: "Private"}}
+	s := newPolicyServer(fake, &policy{Lists: []string{"Inbox"}})
+
+	text, isErr := toolResult(t, callTool(s, toolListTasks, map[string]interface{}{}))
+	if !isErr || !strings.Contains(text, `"Private"`) {
+		t.Errorf("expected the default list to be checked as Private, got %q", text)
+	}
+}
+
+func TestPolicy_RestrictsResourcesAndPrompts(t *testing.T) {
+	fake := &fakeTasks{taskLists: policyLists, task: &tasks.Task{Id: "t1", Title: "Secret plan"}}
+	s := newPolicyServer(fake, &policy{
+		Lists: []string{"Agent *"},
+		Tools: map[string]toolPolicy{toolListTasks: {Lists: []string{"*"}}},
+	})
+	ctx := context.Background()
+
+	resp := s.handleRequest(ctx, JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "resources/list"})
+	var names []string
+	for _, r := range resp.Result.(map[string]interface{})["resources"].([]map[string]interface{}) {
+		names = append(names, r["name"].(string))
+	}
+	if strings.Join(names, ",") != "Agent scratch,Agent plans" {
+		t.Errorf("expected only allowed lists as resources, got %v", names)
+	}
+
+	for _, uri := range []string{"gtasks://lists/private", "gtasks://lists/private/tasks/t1"} {
+		resp = s.handleRequest(ctx, resourceRequest("resources/read", uri))
+		if resp.Error == nil || !strings.Contains(resp.Error.Data.(string), "outside the server's policy") {
+			t.Errorf("%s: expected policy error, got %+v", uri, resp)
+		}
+	}
+	if resp := s.handleRequest(ctx, resourceRequest("resources/read", "gtasks://lists/agent1")); resp.Error != nil {
+		t.Errorf("expected allowed list to be readable, got %+v", resp.Error)
+	}
+
+	resp, _ = getPrompt(t, s, promptTriageInbox, map[string]string{"tasklist": "Private"})
+	if resp.Error == nil || !strings.Contains(resp.Error.Data.(string), "outside the server's policy") {
+		t.Errorf("expected prompt over a denied list to fail, got %+v", resp)
+	}
+
+	fake.tasksByList = map[string][]TaskItem{
+		"agent1":  {{ID: "t2", Title: "Agent chore", Status: "needsAction", Due: "2020-01-01T00:00:00.000Z"}},
+		"private": {{ID: "t1", Title: "Secret plan", Status: "needsAction", Due: "2020-01-01T00:00:00.000Z"}},
+	}
+	_, text := getPrompt(t, s, promptDailyPlan, nil)
+	if !strings.Contains(text, "Agent chore") || strings.Contains(text, "Secret plan") {
+		t.Errorf("expected prompts over all lists to skip denied ones, got:\n%s", text)
+	}
+}
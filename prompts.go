@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	promptDailyPlan    = "daily_plan"
+	promptWeeklyReview = "weekly_review"
+	promptTriageInbox  = "triage_inbox"
+)
+
+// prompts describes the prompts offered by prompts/list, in display order.
+var prompts = []map[string]interface{}{
+	{
+		"name":        promptDailyPlan,
+		"description": "Plan the day from overdue tasks and tasks due today across task lists",
+		"arguments": []map[string]interface{}{
+			{"name": "date", "description": "Day to plan (YYYY-MM-DD), defaults to today"},
+			{"name": "tasklist", "description": "Only plan from this task list (name), defaults to all lists"},
+			{"name": "account", "description": "Account to plan for, defaults to the default account"},
+		},
+	},
+	{
+		"name":        promptWeeklyReview,
+		"description": "Review the past week's completed tasks and plan the open and upcoming ones",
+		"arguments": []map[string]interface{}{
+			{"name": "date", "description": "Last day of the week under review (YYYY-MM-DD), defaults to today"},
+			{"name": "tasklist", "description": "Only review this task list (name), defaults to all lists"},
+			{"name": "account", "description": "Account to review, defaults to the default account"},
+		},
+	},
+	{
+		"name":        promptTriageInbox,
+		"description": "Triage open tasks without a due date: schedule, move, or drop each one",
+		"arguments": []map[string]interface{}{
+			{"name": "tasklist", "description": "Task list to triage (name), defaults to the default list"},
+			{"name": "account", "description": "Account to triage, defaults to the default account"},
+		},
+	},
+}
+
+func (s *Server) handlePromptsList(req JSONRPCRequest) *JSONRPCResponse {
+	return &JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"prompts": prompts,
+		},
+	}
+}
+
+func (s *Server) handlePromptsGet(ctx context.Context, req JSONRPCRequest) *JSONRPCResponse {
+	var params struct {
+		Name      string            `json:"name"`
+		Arguments map[string]string `json:"arguments"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return s.paramError(req.ID, "Invalid params", err.Error())
+	}
+
+	acct, err := s.findAccount(params.Arguments["account"])
+	if err != nil {
+		return s.paramError(req.ID, "Invalid params", err.Error())
+	}
+	ctx = withAccount(ctx, acct)
+
+	var description, text string
+	switch params.Name {
+	case promptDailyPlan:
+		description = "Daily plan"
+		text, err = s.dailyPlanPrompt(ctx, params.Arguments)
+	case promptWeeklyReview:
+		description = "Weekly review"
+		text, err = s.weeklyReviewPrompt(ctx, params.Arguments)
+	case promptTriageInbox:
+		description = "Inbox triage"
+		text, err = s.triageInboxPrompt(ctx, params.Arguments)
+	default:
+		return s.paramError(req.ID, "Unknown prompt", params.Name)
+	}
+	if err != nil {
+		return s.rpcError(req.ID, -32603, "Failed to build prompt", err.Error())
+	}
+
+	return &JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"description": description,
+			"messages": []map[string]interface{}{
+				{
+					"role":    "user",
+					"content": map[string]string{"type": "text", "text": text},
+				},
+			},
+		},
+	}
+}
+
+func (s *Server) dailyPlanPrompt(ctx context.Context, args map[string]string) (string, error) {
+	day, err := s.promptDate(args["date"])
+	if err != nil {
+		return "", err
+	}
+	today := day.Format("2006-01-02")
+
+	var overdue, dueToday []string
+	err = s.eachTask(ctx, args["tasklist"], TaskFilter{}, func(list TaskListItem, t TaskItem) {
+		if t.Status == "completed" || t.Due == "" {
+			return
+		}
+		switch due := dueDay(t.Due); {
+		case due < today:
+			overdue = append(overdue, s.promptTaskLine(list, t))
+		case due == today:
+			dueToday = append(dueToday, s.promptTaskLine(list, t))
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Help me plan my day for %s.\n\n", today)
+	b.WriteString("Propose a realistic order for the tasks below, putting overdue and time-sensitive work first. ")
+	b.WriteString("Point out anything that should be rescheduled rather than done today, and suggest new due dates for it. ")
+	b.WriteString("Use the task IDs with the update_task or complete_task tools if I ask you to apply changes.\n")
+	writePromptSection(&b, "Overdue", overdue)
+	writePromptSection(&b, "Due today", dueToday)
+	return b.String(), nil
+}
+
+func (s *Server) weeklyReviewPrompt(ctx context.Context, args map[string]string) (string, error) {
+	day, err := s.promptDate(args["date"])
+	if err != nil {
+		return "", err
+	}
+	end := day.Format("2006-01-02")
+	start := day.AddDate(0, 0, -6).Format("2006-01-02")
+	nextWeek := day.AddDate(0, 0, 7).Format("2006-01-02")
+
+	var completed, overdue, upcoming, undated []string
+	// Tasks completed in Google's own apps are hidden, so ask for those too
+	err = s.eachTask(ctx, args["tasklist"], TaskFilter{ShowCompleted: true, ShowHidden: true}, func(list TaskListItem, t TaskItem) {
+		line := s.promptTaskLine(list, t)
+		if t.Status == "completed" {
+			if t.Completed != "" {
+				if done := dayIn(t.Completed, s.loc); done >= start && done <= end {
+					completed = append(completed, line)
+				}
+			}
+			return
+		}
+		if t.Due == "" {
+			undated = append(undated, line)
+			return
+		}
+		switch due := dueDay(t.Due); {
+		case due <= end:
+			overdue = append(overdue, line)
+		case due <= nextWeek:
+			upcoming = append(upcoming, line)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Run a weekly review with me for %s to %s.\n\n", start, end)
+	b.WriteString("Summarise what got done, then go through the open tasks: which are still relevant, which need a new due date, and which can be dropped. ")
+	b.WriteString("Finish with the three most important tasks for the coming week. ")
+	b.WriteString("Use the task IDs with the task tools if I ask you to apply changes.\n")
+	writePromptSection(&b, "Completed this week", completed)
+	writePromptSection(&b, "Open and due by "+end, overdue)
+	writePromptSection(&b, "Due in the next 7 days", upcoming)
+	writePromptSection(&b, "Open without a due date", undated)
+	return b.String(), nil
+}
+
+func (s *Server) triageInboxPrompt(ctx context.Context, args map[string]string) (string, error) {
+	list, err := s.readableList(ctx, "", args["tasklist"])
+	if err != nil {
+		return "", err
+	}
+	lists, err := s.cachedTaskLists(ctx, false)
+	if err != nil {
+		return "", err
+	}
+
+	others := make([]string, 0, len(lists))
+	for _, l := range s.policy.filterLists("", lists) {
+		if l.ID != list.ID {
+			others = append(others, l.Title)
+		}
+	}
+
+	taskItems, err := s.account(ctx).tasks.ListTasks(ctx, list.ID, false)
+	if err != nil {
+		return "", err
+	}
+	var untriaged []string
+	for _, t := range taskItems {
+		if t.Due == "" {
+			untriaged = append(untriaged, s.promptTaskLine(list, t))
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Help me triage the %q task list.\n\n", list.Title)
+	b.WriteString("For each task below, which has no due date yet, suggest exactly one action: schedule it with a due date, move it to a better task list, break it into subtasks, or delete it. ")
+	b.WriteString("Ask before applying anything, then use update_task, move_task, create_task or delete_task with the task IDs.\n")
+	if len(others) > 0 {
+		fmt.Fprintf(&b, "\nOther task lists: %s\n", strings.Join(others, ", "))
+	}
+	writePromptSection(&b, "Untriaged tasks", untriaged)
+	return b.String(), nil
+}
+
+// eachTask calls fn for every task matching filter in the named list, or in
+// all lists when name is empty.
+func (s *Server) eachTask(ctx context.Context, name string, filter TaskFilter, fn func(TaskListItem, TaskItem)) error {
+	var scope []TaskListItem
+	if name == "" {
+		all, err := s.cachedTaskLists(ctx, false)
+		if err != nil {
+			return err
+		}
+		scope = s.policy.filterLists("", all)
+	} else {
+		list, err := s.readableList(ctx, "", name)
+		if err != nil {
+			return err
+		}
+		scope = []TaskListItem{list}
+	}
+
+	for _, list := range scope {
+		taskItems, err := s.account(ctx).tasks.FilterTasks(ctx, list.ID, filter)
+		if err != nil {
+			return fmt.Errorf("task list %q: %w", list.Title, err)
+		}
+		for _, t := range taskItems {
+			fn(list, t)
+		}
+	}
+	return nil
+}
+
+// promptDate parses an optional YYYY-MM-DD argument, defaulting to today.
+func (s *Server) promptDate(date string) (time.Time, error) {
+	loc := s.loc
+	if loc == nil {
+		loc = time.UTC
+	}
+	if date == "" {
+		return time.Now().In(loc), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+	}
+	return t, nil
+}
+
+// dueDay returns the YYYY-MM-DD day a task is due. Google stores due dates as
+// midnight UTC, so they are read in UTC whatever the configured timezone.
+func dueDay(rfc3339 string) string {
+	return dayIn(rfc3339, time.UTC)
+}
+
+// dayIn returns the YYYY-MM-DD day of an RFC3339 timestamp in loc.
+func dayIn(rfc3339 string, loc *time.Location) string {
+	d := formatDue(rfc3339, loc)
+	if len(d) > len("2006-01-02") {
+		d = d[:len("2006-01-02")]
+	}
+	return d
+}
+
+func (s *Server) promptTaskLine(list TaskListItem, t TaskItem) string {
+	line := fmt.Sprintf("- %s (list: %s, ID: %s", t.Title, list.Title, t.ID)
+	if t.Due != "" {
+		line += ", due " + dueDay(t.Due)
+	}
+	line += ")"
+	if t.Notes != "" {
+		line += "\n  Notes: " + t.Notes
+	}
+	return line
+}
+
+func writePromptSection(b *strings.Builder, heading string, lines []string) {
+	fmt.Fprintf(b, "\n## %s\n", heading)
+	if len(lines) == 0 {
+		b.WriteString("None.\n")
+		return
+	}
+	for _, line := range lines {
+		b.WriteString(line + "\n")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/tasks/v1"
+)
+
+func getPrompt(t *testing.T, s *Server, name string, args map[string]string) (*JSONRPCResponse, string) {
+	t.Helper()
+	params, _ := json.Marshal(map[string]interface{}{"name": name, "arguments": args})
+	resp := s.handleRequest(context.Background(), JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "prompts/get", Params: params})
+	if resp.Error != nil {
+		return resp, ""
+	}
+	messages := resp.Result.(map[string]interface{})["messages"].([]map[string]interface{})
+	if len(messages) != 1 || messages[0]["role"] != "user" {
+		t.Fatalf("expected one user message, got %v", messages)
+	}
+	return resp, messages[0]["content"].(map[string]string)["text"]
+}
+
+func TestHandlePromptsList(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+
+	resp := s.handleRequest(context.Background(), JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "prompts/list"})
+	list := resp.Result.(map[string]interface{})["prompts"].([]map[string]interface{})
+
+	var names []string
+	for _, p := range list {
+		names = append(names, p["name"].(string))
+	}
+	if strings.Join(names, ",") != "daily_plan,weekly_review,triage_inbox" {
+		t.Errorf("unexpected prompts: %v", names)
+	}
+}
+
+func TestPromptDailyPlan(t *testing.T) {
+	fake := &fakeTasks{
+		taskLists: []TaskListItem{{ID: "list1", Title: "Work"}, {ID: "list2", Title: "Home"}},
+		tasksByList: map[string][]TaskItem{
+			"list1": {
+				{ID: "t1", Title: "Late report", Status: "needsAction", Due: "2025-03-09T00:00:00.000Z"},
+				{ID: "t2", Title: "Standup", Status: "needsAction", Due: "2025-03-10T00:00:00.000Z"},
+				{ID: "t3", Title: "Next week", Status: "needsAction", Due: "2025-03-17T00:00:00.000Z"},
+			},
+			"list2": {
+				{ID: "t4", Title: "Laundry", Status: "needsAction", Due: "2025-03-10T00:00:00.000Z"},
+				{ID: "t5", Title: "Someday", Status: "needsAction"},
+			},
+		},
+	}
+	s := newTestServer(fake)
+
+	_, text := getPrompt(t, s, "daily_plan", map[string]string{"date": "2025-03-10"})
+
+	overdue := text[strings.Index(text, "## Overdue"):strings.Index(text, "## Due today")]
+	today := text[strings.Index(text, "## Due today"):]
+	if !strings.Contains(overdue, "Late report (list: Work, ID: t1") {
+		t.Errorf("expected overdue task, got:\n%s", overdue)
+	}
+	if !strings.Contains(today, "Standup") || !strings.Contains(today, "Laundry (list: Home") {
+		t.Errorf("expected tasks due today from both lists, got:\n%s", today)
+	}
+	if strings.Contains(text, "Next week") || strings.Contains(text, "Someday") {
+		t.Errorf("expected future and undated tasks to be left out, got:\n%s", text)
+	}
+}
+
+func TestPromptDailyPlan_WestOfUTC(t *testing.T) {
+	fake := &fakeTasks{
+		taskLists: []TaskListItem{{ID: "list1", Title: "Work"}},
+		taskItems: []TaskItem{
+			{ID: "t1", Title: "Standup", Status: "needsAction", Due: "2025-03-10T00:00:00.000Z"},
+		},
+	}
+	s := newTestServer(fake)
+	s.loc = time.FixedZone("EST", -5*60*60)
+
+	_, text := getPrompt(t, s, "daily_plan", map[string]string{"date": "2025-03-10"})
+
+	overdue := text[strings.Index(text, "## Overdue"):strings.Index(text, "## Due today")]
+	today := text[strings.Index(text, "## Due today"):]
+	if strings.Contains(overdue, "Standup") || !strings.Contains(today, "Standup (list: Work, ID: t1, due 2025-03-10)") {
+		t.Errorf("expected the task due today under Due today, got:\n%s", text)
+	}
+}
+
+func TestPromptWeeklyReview_WestOfUTC(t *testing.T) {
+	fake := &fakeTasks{
+		taskLists: []TaskListItem{{ID: "list1", Title: "Work"}},
+		taskItems: []TaskItem{
+			{ID: "t1", Title: "Shipped", Status: "completed", Completed: "2025-03-11T03:00:00.000Z"},
+			{ID: "t2", Title: "Soon", Status: "needsAction", Due: "2025-03-11T00:00:00.000Z"},
+		},
+	}
+	s := newTestServer(fake)
+	s.loc = time.FixedZone("EST", -5*60*60)
+
+	_, text := getPrompt(t, s, "weekly_review", map[string]string{"date": "2025-03-10"})
+
+	// Completed at 22:00 local on the 10th, due on the 11th
+	completed := text[strings.Index(text, "## Completed this week"):strings.Index(text, "## Open and due by")]
+	due := text[strings.Index(text, "## Open and due by"):strings.Index(text, "## Due in the next 7 days")]
+	if !strings.Contains(completed, "Shipped") {
+		t.Errorf("expected the completion time to be read in local time, got:\n%s", text)
+	}
+	if strings.Contains(due, "Soon") {
+		t.Errorf("expected the task due tomorrow not to be overdue, got:\n%s", text)
+	}
+}
+
+func TestPromptDailyPlan_SingleList(t *testing.T) {
+	fake := &fakeTasks{
+		taskLists:   []TaskListItem{{ID: "list1", Title: "Work"}, {ID: "list2", Title: "Home"}},
+		tasksByList: map[string][]TaskItem{"list1": {}, "list2": {}},
+	}
+	s := newTestServer(fake)
+
+	_, text := getPrompt(t, s, "daily_plan", map[string]string{"date": "2025-03-10", "tasklist": "home"})
+	if strings.Join(fake.searchedLists, ",") != "list2" {
+		t.Errorf("expected only list2 to be read, got %v", fake.searchedLists)
+	}
+	if !strings.Contains(text, "## Due today\nNone.") {
+		t.Errorf("expected empty section, got:\n%s", text)
+	}
+}
+
+func TestPromptWeeklyReview(t *testing.T) {
+	fake := &fakeTasks{
+		taskLists: []TaskListItem{{ID: "list1", Title: "Work"}},
+		taskItems: []TaskItem{
+			{ID: "t1", Title: "Shipped", Status: "completed", Completed: "2025-03-08T15:00:00.000Z"},
+			{ID: "t2", Title: "Old win", Status: "completed", Completed: "2025-02-01T15:00:00.000Z"},
+			{ID: "t3", Title: "Slipped", Status: "needsAction", Due: "2025-03-05T00:00:00.000Z"},
+			{ID: "t4", Title: "Soon", Status: "needsAction", Due: "2025-03-14T00:00:00.000Z"},
+			{ID: "t5", Title: "Whenever", Status: "needsAction"},
+		},
+	}
+	s := newTestServer(fake)
+
+	_, text := getPrompt(t, s, "weekly_review", map[string]string{"date": "2025-03-10"})
+	if !fake.lastFilter.ShowCompleted || !fake.lastFilter.ShowHidden {
+		t.Error("expected completed and hidden tasks to be requested")
+	}
+	if !strings.Contains(text, "2025-03-04 to 2025-03-10") {
+		t.Errorf("expected review window, got:\n%s", text)
+	}
+
+	sections := map[string]string{
+		"Completed this week":        "Shipped",
+		"Open and due by 2025-03-10": "Slipped",
+		"Due in the next 7 days":     "Soon",
+		"Open without a due date":    "Whenever",
+	}
+	for heading, title := range sections {
+		start := strings.Index(text, "## "+heading)
+		if start < 0 {
+			t.Fatalf("missing section %q in:\n%s", heading, text)
+		}
+		section := text[start:]
+		if next := strings.Index(section[3:], "## "); next >= 0 {
+			section = section[:next+3]
+		}
+		if !strings.Contains(section, title) {
+			t.Errorf("expected %q under %q, got:\n%s", title, heading, section)
+		}
+	}
+	if strings.Contains(text, "Old win") {
+		t.Errorf("expected tasks completed before the week to be left out, got:\n%s", text)
+	}
+}
+
+func TestPromptTriageInbox(t *testing.T) {
+	fake := &fakeTasks{
+		taskLists: []TaskListItem{{ID: "inbox", Title: "Inbox"}, {ID: "list2", Title: "Projects"}},
+		taskItems: []TaskItem{
+			{ID: "t1", Title: "Call plumber", Status: "needsAction"},
+			{ID: "t2", Title: "Scheduled", Status: "needsAction", Due: "2025-03-10T00:00:00.000Z"},
+		},
+	}
+	s := newTestServer(fake)
+
+	_, text := getPrompt(t, s, "triage_inbox", map[string]string{"tasklist": "Inbox"})
+	if fake.lastTasklist != "inbox" {
+		t.Errorf("expected inbox list, got %q", fake.lastTasklist)
+	}
+	if !strings.Contains(text, "Call plumber (list: Inbox, ID: t1)") {
+		t.Errorf("expected untriaged task, got:\n%s", text)
+	}
+	if strings.Contains(text, "Scheduled") {
+		t.Errorf("expected tasks with a due date to be left out, got:\n%s", text)
+	}
+	if !strings.Contains(text, "Other task lists: Projects") {
+		t.Errorf("expected other lists as move targets, got:\n%s", text)
+	}
+}
+
+func TestPromptTriageInbox_DefaultList(t *testing.T) {
+	fake := &fakeTasks{
+		taskLists:   []TaskListItem{{ID: "list2", Title: "Projects"}, {ID: "inbox", Title: "Inbox"}},
+		defaultList: &tasks.TaskList{Id: "inbox", Title: "Inbox"},
+		taskItems:   []TaskItem{{ID: "t1", Title: "Call plumber", Status: "needsAction"}},
+	}
+	s := newTestServer(fake)
+
+	_, text := getPrompt(t, s, "triage_inbox", nil)
+	if !strings.Contains(text, `triage the "Inbox" task list`) || !strings.Contains(text, "Call plumber (list: Inbox, ID: t1)") {
+		t.Errorf("expected the default list by its title, got:\n%s", text)
+	}
+	if !strings.Contains(text, "Other task lists: Projects\n") {
+		t.Errorf("expected the default list left out of the other lists, got:\n%s", text)
+	}
+}
+
+func TestPromptsGet_Errors(t *testing.T) {
+	s := newTestServer(&fakeTasks{taskLists: []TaskListItem{{ID: "list1", Title: "Work"}}})
+
+	resp, _ := getPrompt(t, s, "unknown", nil)
+	if resp.Error == nil || resp.Error.Code != -32602 {
+		t.Errorf("expected invalid params for unknown prompt, got %+v", resp.Error)
+	}
+
+	resp, _ = getPrompt(t, s, "daily_plan", map[string]string{"date": "tomorrow"})
+	if resp.Error == nil || !strings.Contains(resp.Error.Data.(string), "invalid date") {
+		t.Errorf("expected invalid date error, got %+v", resp.Error)
+	}
+}
+
+func TestPromptsGet_Account(t *testing.T) {
+	personal := &fakeTasks{taskLists: []TaskListItem{{ID: "p-list", Title: "Inbox"}}}
+	work := &fakeTasks{taskLists: []TaskListItem{{ID: "w-list", Title: "Inbox"}}}
+	s := newMultiAccountServer(personal, work)
+
+	getPrompt(t, s, "triage_inbox", map[string]string{"tasklist": "Inbox", "account": "work"})
+	if work.lastTasklist != "w-list" || personal.lastTasklist != "" {
+		t.Errorf("expected the work account to be used, got %q and %q", work.lastTasklist, personal.lastTasklist)
+	}
+
+	resp, _ := getPrompt(t, s, "triage_inbox", map[string]string{"account": "other"})
+	if resp.Error == nil || resp.Error.Code != -32602 {
+		t.Errorf("expected invalid params for unknown account, got %+v", resp.Error)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// resolveTasklist returns the task list ID to use for a tool call.
+// An explicit tasklistID wins; otherwise name is resolved against the user's
+// task lists, and with neither set the default list is used.
+func (s *Server) resolveTasklist(ctx context.Context, tasklistID, name string) (string, error) {
+	return s.resolveTasklistMatching(ctx, tasklistID, name, false)
+}
+
+// resolveTasklistExact is resolveTasklist for tools that change tasks: a name
+// must equal a list's title (case-insensitively), so that a typo can't pick
+// a different list to write to or delete from.
+func (s *Server) resolveTasklistExact(ctx context.Context, tasklistID, name string) (string, error) {
+	return s.resolveTasklistMatching(ctx, tasklistID, name, true)
+}
+
+func (s *Server) resolveTasklistMatching(ctx context.Context, tasklistID, name string, exact bool) (string, error) {
+	if tasklistID != "" {
+		return tasklistID, nil
+	}
+	if strings.TrimSpace(name) == "" {
+		return defaultTasklistID, nil
+	}
+
+	lists, err := s.cachedTaskLists(ctx, false)
+	if err != nil {
+		return "", err
+	}
+
+	matches := matchTaskLists(lists, name)
+	if len(matches) == 0 || (exact && !isExactMatch(matches[0], name)) {
+		// The list may have been created since the cache was filled
+		lists, err = s.cachedTaskLists(ctx, true)
+		if err != nil {
+			return "", err
+		}
+		matches = matchTaskLists(lists, name)
+	}
+
+	if exact && len(matches) > 0 && !isExactMatch(matches[0], name) {
+		return "", fmt.Errorf("no task list is named exactly %q (did you mean %s?); this tool changes tasks, so pass the full name or tasklist_id", name, describeTaskLists(matches))
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no task list matches %q (available: %s)", name, describeTaskLists(lists))
+	case 1:
+		return matches[0].ID, nil
+	default:
+		return "", fmt.Errorf("task list name %q is ambiguous, matches: %s; use tasklist_id or a more specific name", name, describeTaskLists(matches))
+	}
+}
+
+// isExactMatch reports whether a list's title is name, ignoring case and
+// surrounding space. matchTaskLists only returns loose matches when there is
+// no exact one, so checking one of its matches covers them all.
+func isExactMatch(l TaskListItem, name string) bool {
+	return strings.EqualFold(strings.TrimSpace(l.Title), strings.TrimSpace(name))
+}
+
+// cachedTaskLists returns the account's task lists, fetching them on first use or when refresh is set.
+func (s *Server) cachedTaskLists(ctx context.Context, refresh bool) ([]TaskListItem, error) {
+	a := s.account(ctx)
+	a.listsMu.Lock()
+	defer a.listsMu.Unlock()
+
+	if a.lists != nil && !refresh {
+		return a.lists, nil
+	}
+
+	lists, err := a.tasks.ListTaskLists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a.lists = lists
+	return lists, nil
+}
+
+// defaultTaskList returns the list that @default stands for, asking Google
+// rather than assuming where it sits among the account's lists.
+func (s *Server) defaultTaskList(ctx context.Context) (TaskListItem, error) {
+	a := s.account(ctx)
+	a.listsMu.Lock()
+	defer a.listsMu.Unlock()
+
+	if a.defaultList != nil {
+		return *a.defaultList, nil
+	}
+
+	l, err := a.tasks.GetTaskList(ctx, defaultTasklistID)
+	if err != nil {
+		return TaskListItem{}, err
+	}
+	item := newTaskListItem(l)
+	a.defaultList = &item
+	return item, nil
+}
+
+// invalidateTaskLists drops the account's cached task lists after they were changed.
+func (s *Server) invalidateTaskLists(ctx context.Context) {
+	a := s.account(ctx)
+	a.listsMu.Lock()
+	a.lists = nil
+	a.defaultList = nil
+	a.listsMu.Unlock()
+}
+
+// matchTaskLists finds the task lists a name refers to, trying progressively looser
+// matches: exact (case-insensitive), then substring, then small edit distance.
+func matchTaskLists(lists []TaskListItem, name string) []TaskListItem {
+	needle := strings.ToLower(strings.TrimSpace(name))
+
+	var exact, partial, fuzzy []TaskListItem
+	for _, l := range lists {
+		title := strings.ToLower(strings.TrimSpace(l.Title))
+		switch {
+		case title == needle:
+			exact = append(exact, l)
+		case strings.Contains(title, needle):
+			partial = append(partial, l)
+		case levenshtein(title, needle) <= maxTypos(needle):
+			fuzzy = append(fuzzy, l)
+		}
+	}
+
+	if len(exact) > 0 {
+		return exact
+	}
+	if len(partial) > 0 {
+		return partial
+	}
+	return fuzzy
+}
+
+// maxTypos is the edit distance tolerated when fuzzy matching a name.
+func maxTypos(name string) int {
+	n := len([]rune(name))
+	if n < 4 {
+		return 0
+	}
+	if n < 8 {
+		return 1
+	}
+	return 2
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// describeTaskLists formats task lists as `"Title" (ID: id)` for error messages.
+func describeTaskLists(lists []TaskListItem) string {
+	if len(lists) == 0 {
+		return "none"
+	}
+	parts := make([]string, 0, len(lists))
+	for _, l := range lists {
+		parts = append(parts, fmt.Sprintf("%q (ID: %s)", l.Title, l.ID))
+	}
+	return strings.Join(parts, ", ")
+}
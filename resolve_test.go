@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/tasks/v1"
+)
+
+var testLists = []TaskListItem{
+	{ID: "id-inbox", Title: "Inbox"},
+	{ID: "id-work", Title: "Work"},
+	{ID: "id-work-proj", Title: "Work Projects"},
+	{ID: "id-groceries", Title: "Groceries"},
+}
+
+func TestMatchTaskLists(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []string
+	}{
+		{"inbox", []string{"id-inbox"}},
+		{"  WORK ", []string{"id-work"}},
+		{"proj", []string{"id-work-proj"}},
+		{"grocceries", []string{"id-groceries"}},
+		{"or", []string{"id-work", "id-work-proj"}},
+		{"nothing like it", nil},
+	}
+
+	for _, tt := range tests {
+		got := matchTaskLists(testLists, tt.name)
+		if len(got) != len(tt.expected) {
+			t.Errorf("%q: expected %v, got %v", tt.name, tt.expected, got)
+			continue
+		}
+		for i, id := range tt.expected {
+			if got[i].ID != id {
+				t.Errorf("%q: expected %v, got %v", tt.name, tt.expected, got)
+			}
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	if d := levenshtein("kitten", "sitting"); d != 3 {
+		t.Errorf("expected distance 3, got %d", d)
+	}
+	if d := levenshtein("", "abc"); d != 3 {
+		t.Errorf("expected distance 3, got %d", d)
+	}
+}
+
+func TestResolveTasklist_Precedence(t *testing.T) {
+	fake := &fakeTasks{taskLists: testLists}
+	s := newTestServer(fake)
+
+	id, err := s.resolveTasklist(context.Background(), "explicit", "Inbox")
+	if err != nil || id != "explicit" {
+		t.Errorf("expected explicit ID to win, got %q (%v)", id, err)
+	}
+
+	id, err = s.resolveTasklist(context.Background(), "", "")
+	if err != nil || id != defaultTasklistID {
+		t.Errorf("expected default list, got %q (%v)", id, err)
+	}
+
+	if fake.listCalls != 0 {
+		t.Errorf("expected no task list lookups, got %d", fake.listCalls)
+	}
+}
+
+func TestResolveTasklist_CachesLists(t *testing.T) {
+	fake := &fakeTasks{taskLists: testLists}
+	s := newTestServer(fake)
+
+	for _, name := range []string{"inbox", "Groceries", "work"} {
+		if _, err := s.resolveTasklist(context.Background(), "", name); err != nil {
+			t.Fatalf("unexpected error resolving %q: %v", name, err)
+		}
+	}
+	if fake.listCalls != 1 {
+		t.Errorf("expected task lists to be fetched once, got %d", fake.listCalls)
+	}
+}
+
+func TestResolveTasklist_RefreshesOnMiss(t *testing.T) {
+	fake := &fakeTasks{taskLists: testLists}
+	s := newTestServer(fake)
+
+	if _, err := s.resolveTasklist(context.Background(), "", "inbox"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fake.taskLists = append(fake.taskLists, TaskListItem{ID: "id-new", Title: "Reading"})
+	id, err := s.resolveTasklist(context.Background(), "", "reading")
+	if err != nil || id != "id-new" {
+		t.Errorf("expected newly created list to resolve, got %q (%v)", id, err)
+	}
+}
+
+func TestResolveTasklist_Ambiguous(t *testing.T) {
+	s := newTestServer(&fakeTasks{taskLists: testLists})
+
+	_, err := s.resolveTasklist(context.Background(), "", "or")
+	if err == nil {
+		t.Fatal("expected ambiguity error")
+	}
+	if !strings.Contains(err.Error(), "id-work") || !strings.Contains(err.Error(), "id-work-proj") {
+		t.Errorf("expected candidates in error, got: %v", err)
+	}
+}
+
+func TestResolveTasklist_NotFound(t *testing.T) {
+	s := newTestServer(&fakeTasks{taskLists: testLists})
+
+	_, err := s.resolveTasklist(context.Background(), "", "Holidays")
+	if err == nil || !strings.Contains(err.Error(), "Inbox") {
+		t.Errorf("expected not found error listing available lists, got: %v", err)
+	}
+}
+
+func TestResolveTasklistExact(t *testing.T) {
+	s := newTestServer(&fakeTasks{taskLists: testLists})
+
+	id, err := s.resolveTasklistExact(context.Background(), "", " groceries ")
+	if err != nil || id != "id-groceries" {
+		t.Errorf("expected exact name to resolve, got %q (%v)", id, err)
+	}
+
+	for _, name := range []string{"grocceries", "proj"} {
+		_, err := s.resolveTasklistExact(context.Background(), "", name)
+		if err == nil || !strings.Contains(err.Error(), "did you mean") {
+			t.Errorf("%q: expected a near miss to be refused, got %v", name, err)
+		}
+	}
+}
+
+func TestCallDestructiveTools_RequireExactName(t *testing.T) {
+	for _, tool := range []string{toolDeleteTaskList, toolDeleteTask, toolClearCompleted} {
+		fake := &fakeTasks{taskLists: testLists}
+		s := newTestServer(fake)
+
+		text, isErr := toolResult(t, callTool(s, tool, map[string]interface{}{"tasklist": "Grocceries", "task_id": "t1", "confirm": true}))
+		if !isErr || !strings.Contains(text, "no task list is named exactly") {
+			t.Errorf("%s: expected typo to be refused, got %q", tool, text)
+		}
+		if fake.deletedList != "" || fake.clearedList != "" || fake.lastTasklist != "" {
+			t.Errorf("%s: expected no API call", tool)
+		}
+	}
+}
+
+func TestCallListTasks_ByName(t *testing.T) {
+	fake := &fakeTasks{taskLists: testLists}
+	s := newTestServer(fake)
+
+	args, _ := json.Marshal(map[string]string{"tasklist": "groceries"})
+	s.callListTasks(context.Background(), float64(1), args)
+	if fake.lastTasklist != "id-groceries" {
+		t.Errorf("expected id-groceries, got %q", fake.lastTasklist)
+	}
+}
+
+func TestCallCreateTaskList_InvalidatesCache(t *testing.T) {
+	fake := &fakeTasks{taskLists: testLists}
+	s := newTestServer(fake)
+
+	if _, err := s.resolveTasklist(context.Background(), "", "inbox"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fake.createdList = &tasks.TaskList{Id: "id-new", Title: "Inbox 2"}
+	args, _ := json.Marshal(map[string]string{"title": "Inbox 2"})
+	s.callCreateTaskList(context.Background(), float64(1), args)
+
+	if _, err := s.resolveTasklist(context.Background(), "", "inbox"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.listCalls != 2 {
+		t.Errorf("expected cache refresh after creating a list, got %d fetches", fake.listCalls)
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	resourceScheme = "gtasks://lists/"
+
+	// defaultPollInterval is how often subscribed resources are checked for changes
+	defaultPollInterval = 30 * time.Second
+
+	// errResourceNotFound is the MCP error code for unknown resource URIs
+	errResourceNotFound = -32002
+)
+
+// notifier delivers server-initiated messages to one connected client.
+type notifier interface {
+	notify(msg interface{})
+}
+
+type notifierKey struct{}
+
+// withNotifier attaches the client connection a request arrived on to ctx.
+func withNotifier(ctx context.Context, n notifier) context.Context {
+	return context.WithValue(ctx, notifierKey{}, n)
+}
+
+func notifierFrom(ctx context.Context) notifier {
+	n, _ := ctx.Value(notifierKey{}).(notifier)
+	return n
+}
+
+// notify writes a server message to stdout, making Server the stdio notifier.
+func (s *Server) notify(msg interface{}) {
+	s.writeMessage(msg)
+}
+
+// taskListURI returns the resource URI for a task list.
+func taskListURI(tasklistID string) string {
+	return resourceScheme + url.PathEscape(tasklistID)
+}
+
+// taskURI returns the resource URI for a single task.
+func taskURI(tasklistID, taskID string) string {
+	return taskListURI(tasklistID) + "/tasks/" + url.PathEscape(taskID)
+}
+
+// parseResourceURI splits a resource URI into its task list and optional task ID.
+func parseResourceURI(uri string) (tasklistID, taskID string, err error) {
+	rest, ok := strings.CutPrefix(uri, resourceScheme)
+	if !ok || rest == "" {
+		return "", "", fmt.Errorf("unsupported resource URI %q", uri)
+	}
+
+	listPart, taskPart, hasTask := strings.Cut(rest, "/tasks/")
+	if tasklistID, err = url.PathUnescape(listPart); err != nil || tasklistID == "" || strings.Contains(listPart, "/") {
+		return "", "", fmt.Errorf("invalid task list in resource URI %q", uri)
+	}
+	if hasTask {
+		if taskID, err = url.PathUnescape(taskPart); err != nil || taskID == "" || strings.Contains(taskPart, "/") {
+			return "", "", fmt.Errorf("invalid task in resource URI %q", uri)
+		}
+	}
+
+	return tasklistID, taskID, nil
+}
+
+func (s *Server) handleResourcesList(ctx context.Context, req JSONRPCRequest) *JSONRPCResponse {
+	lists, err := s.cachedTaskLists(ctx, true)
+	if err != nil {
+		return s.rpcError(req.ID, -32603, "Failed to list task lists", err.Error())
+	}
+
+	lists = s.policy.filterLists("", lists)
+	resources := make([]map[string]interface{}, 0, len(lists))
+	for _, l := range lists {
+		resources = append(resources, map[string]interface{}{
+			"uri":         taskListURI(l.ID),
+			"name":        l.Title,
+			"description": fmt.Sprintf("Open tasks in the %q task list", l.Title),
+			"mimeType":    "text/plain",
+		})
+	}
+
+	return &JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"resources": resources,
+		},
+	}
+}
+
+func (s *Server) handleResourceTemplatesList(req JSONRPCRequest) *JSONRPCResponse {
+	return &JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"resourceTemplates": []map[string]interface{}{
+				{
+					"uriTemplate": resourceScheme + "{tasklistId}",
+					"name":        "Task list",
+					"description": "Open tasks in a task list, as an indented subtask tree",
+					"mimeType":    "text/plain",
+				},
+				{
+					"uriTemplate": resourceScheme + "{tasklistId}/tasks/{taskId}",
+					"name":        "Task",
+					"description": "A single task with its notes, due date and status",
+					"mimeType":    "text/plain",
+				},
+			},
+		},
+	}
+}
+
+func (s *Server) handleResourcesRead(ctx context.Context, req JSONRPCRequest) *JSONRPCResponse {
+	uri, errResp := s.resourceURIParam(req)
+	if errResp != nil {
+		return errResp
+	}
+
+	text, err := s.readResource(ctx, uri)
+	if err != nil {
+		return s.rpcError(req.ID, errResourceNotFound, "Resource not found", err.Error())
+	}
+
+	return &JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"contents": []map[string]string{
+				{"uri": uri, "mimeType": "text/plain", "text": text},
+			},
+		},
+	}
+}
+
+func (s *Server) handleResourcesSubscribe(ctx context.Context, req JSONRPCRequest) *JSONRPCResponse {
+	uri, errResp := s.resourceURIParam(req)
+	if errResp != nil {
+		return errResp
+	}
+
+	n := notifierFrom(ctx)
+	if n == nil {
+		return s.rpcError(req.ID, -32603, "Subscriptions are not supported on this connection", nil)
+	}
+
+	// Read now so the first poll only reports real changes
+	text, err := s.readResource(ctx, uri)
+	if err != nil {
+		return s.rpcError(req.ID, errResourceNotFound, "Resource not found", err.Error())
+	}
+
+	s.subsMu.Lock()
+	if s.subs == nil {
+		s.subs = make(map[string]*subscription)
+	}
+	sub, ok := s.subs[uri]
+	if !ok {
+		sub = &subscription{notifiers: make(map[notifier]bool), digest: digest(text)}
+		s.subs[uri] = sub
+	}
+	sub.notifiers[n] = true
+	s.subsMu.Unlock()
+
+	return &JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]interface{}{}}
+}
+
+func (s *Server) handleResourcesUnsubscribe(ctx context.Context, req JSONRPCRequest) *JSONRPCResponse {
+	uri, errResp := s.resourceURIParam(req)
+	if errResp != nil {
+		return errResp
+	}
+
+	if n := notifierFrom(ctx); n != nil {
+		s.subsMu.Lock()
+		if sub, ok := s.subs[uri]; ok {
+			delete(sub.notifiers, n)
+			if len(sub.notifiers) == 0 {
+				delete(s.subs, uri)
+			}
+		}
+		s.subsMu.Unlock()
+	}
+
+	return &JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]interface{}{}}
+}
+
+// unsubscribeAll drops every subscription held by a disconnected client.
+func (s *Server) unsubscribeAll(n notifier) {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+
+	for uri, sub := range s.subs {
+		delete(sub.notifiers, n)
+		if len(sub.notifiers) == 0 {
+			delete(s.subs, uri)
+		}
+	}
+}
+
+// resourceURIParam extracts the uri parameter shared by the resources/* methods.
+func (s *Server) resourceURIParam(req JSONRPCRequest) (string, *JSONRPCResponse) {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return "", s.paramError(req.ID, "Invalid params", err.Error())
+	}
+	if params.URI == "" {
+		return "", s.paramError(req.ID, "uri is required", nil)
+	}
+	return params.URI, nil
+}
+
+// readResource renders the current text of a task list or task resource.
+func (s *Server) readResource(ctx context.Context, uri string) (string, error) {
+	tasklistID, taskID, err := parseResourceURI(uri)
+	if err != nil {
+		return "", err
+	}
+	if s.policy.listPatterns("") != nil {
+		if _, err := s.readableList(ctx, tasklistID, ""); err != nil {
+			return "", err
+		}
+	}
+
+	if taskID != "" {
+		task, err := s.account(ctx).tasks.GetTask(ctx, tasklistID, taskID)
+		if err != nil {
+			return "", err
+		}
+		item := newTaskItem(task)
+		text := s.renderTaskTree([]TaskItem{item})
+		if item.Completed != "" {
+			text += fmt.Sprintf("Completed: %s\n", formatDue(item.Completed, s.loc))
+		}
+		return text, nil
+	}
+
+	taskItems, err := s.account(ctx).tasks.ListTasks(ctx, tasklistID, false)
+	if err != nil {
+		return "", err
+	}
+	if len(taskItems) == 0 {
+		return "No tasks found.", nil
+	}
+	return s.renderTaskTree(taskItems), nil
+}
+
+// subscription tracks who is subscribed to a resource and what they last saw.
+type subscription struct {
+	notifiers map[notifier]bool
+	digest    string
+}
+
+func digest(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return string(sum[:])
+}
+
+// watchResources polls subscribed resources until ctx is done.
+func (s *Server) watchResources(ctx context.Context) {
+	interval := s.pollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.pollResources(ctx)
+		}
+	}
+}
+
+// pollResources re-reads every subscribed resource and sends
+// notifications/resources/updated to its subscribers when it changed.
+func (s *Server) pollResources(ctx context.Context) {
+	s.subsMu.Lock()
+	uris := make([]string, 0, len(s.subs))
+	for uri := range s.subs {
+		uris = append(uris, uri)
+	}
+	s.subsMu.Unlock()
+
+	for _, uri := range uris {
+		text, err := s.readResource(ctx, uri)
+		if err != nil {
+			log.Printf("Polling %s failed: %v", uri, err)
+			continue
+		}
+		d := digest(text)
+
+		s.subsMu.Lock()
+		sub, ok := s.subs[uri]
+		if !ok || sub.digest == d {
+			s.subsMu.Unlock()
+			continue
+		}
+		sub.digest = d
+		notifiers := make([]notifier, 0, len(sub.notifiers))
+		for n := range sub.notifiers {
+			notifiers = append(notifiers, n)
+		}
+		s.subsMu.Unlock()
+
+		msg := map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "notifications/resources/updated",
+			"params":  map[string]string{"uri": uri},
+		}
+		for _, n := range notifiers {
+			n.notify(msg)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/tasks/v1"
+)
+
+// recordingNotifier collects the messages sent to a subscriber.
+type recordingNotifier struct {
+	mu   sync.Mutex
+	msgs []map[string]interface{}
+}
+
+func (n *recordingNotifier) notify(msg interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.msgs = append(n.msgs, msg.(map[string]interface{}))
+}
+
+func (n *recordingNotifier) count() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.msgs)
+}
+
+func resourceRequest(method, uri string) JSONRPCRequest {
+	params, _ := json.Marshal(map[string]string{"uri": uri})
+	return JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: method, Params: params}
+}
+
+func TestParseResourceURI(t *testing.T) {
+	tests := []struct {
+		uri      string
+		tasklist string
+		task     string
+		wantErr  bool
+	}{
+		{uri: "gtasks://lists/list1", tasklist: "list1"},
+		{uri: "gtasks://lists/list1/tasks/task1", tasklist: "list1", task: "task1"},
+		{uri: taskURI("a/b", "c d"), tasklist: "a/b", task: "c d"},
+		{uri: "gtasks://lists/", wantErr: true},
+		{uri: "gtasks://lists/list1/tasks/", wantErr: true},
+		{uri: "gtasks://lists/list1/other", wantErr: true},
+		{uri: "https://example.com/list1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tasklist, task, err := parseResourceURI(tt.uri)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.uri)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.uri, err)
+			continue
+		}
+		if tasklist != tt.tasklist || task != tt.task {
+			t.Errorf("%s: expected (%q, %q), got (%q, %q)", tt.uri, tt.tasklist, tt.task, tasklist, task)
+		}
+	}
+}
+
+func TestHandleResourcesList(t *testing.T) {
+	fake := &fakeTasks{taskLists: []TaskListItem{{ID: "list1", Title: "Work"}, {ID: "list2", Title: "Home"}}}
+	s := newTestServer(fake)
+
+	resp := s.handleRequest(context.Background(), JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "resources/list"})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %+v", resp.Error)
+	}
+
+	resources := resp.Result.(map[string]interface{})["resources"].([]map[string]interface{})
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(resources))
+	}
+	if resources[0]["uri"] != "gtasks://lists/list1" || resources[0]["name"] != "Work" {
+		t.Errorf("unexpected first resource: %v", resources[0])
+	}
+}
+
+func TestHandleResourceTemplatesList(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+
+	resp := s.handleRequest(context.Background(), JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "resources/templates/list"})
+	templates := resp.Result.(map[string]interface{})["resourceTemplates"].([]map[string]interface{})
+	if len(templates) != 2 {
+		t.Fatalf("expected 2 templates, got %d", len(templates))
+	}
+	if templates[1]["uriTemplate"] != "gtasks://lists/{tasklistId}/tasks/{taskId}" {
+		t.Errorf("unexpected task template: %v", templates[1]["uriTemplate"])
+	}
+}
+
+func TestHandleResourcesRead_TaskList(t *testing.T) {
+	fake := &fakeTasks{taskItems: []TaskItem{
+		{ID: "t1", Title: "Parent", Status: "needsAction"},
+		{ID: "t2", Title: "Child", Status: "needsAction", Parent: "t1"},
+	}}
+	s := newTestServer(fake)
+
+	resp := s.handleRequest(context.Background(), resourceRequest("resources/read", "gtasks://lists/list1"))
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %+v", resp.Error)
+	}
+
+	contents := resp.Result.(map[string]interface{})["contents"].([]map[string]string)
+	if fake.lastTasklist != "list1" || fake.lastCompleted {
+		t.Errorf("expected open tasks of list1, got %q (completed=%v)", fake.lastTasklist, fake.lastCompleted)
+	}
+	if contents[0]["uri"] != "gtasks://lists/list1" || contents[0]["mimeType"] != "text/plain" {
+		t.Errorf("unexpected contents: %v", contents[0])
+	}
+	if !strings.Contains(contents[0]["text"], "    [ ] Child") {
+		t.Errorf("expected indented subtask, got:\n%s", contents[0]["text"])
+	}
+}
+
+func TestHandleResourcesRead_Task(t *testing.T) {
+	fake := &fakeTasks{task: &tasks.Task{Id: "t1", Title: "Buy milk", Notes: "2 litres", Status: "needsAction"}}
+	s := newTestServer(fake)
+
+	resp := s.handleRequest(context.Background(), resourceRequest("resources/read", "gtasks://lists/list1/tasks/t1"))
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %+v", resp.Error)
+	}
+
+	text := resp.Result.(map[string]interface{})["contents"].([]map[string]string)[0]["text"]
+	if fake.lastTasklist != "list1" || fake.lastTaskID != "t1" {
+		t.Errorf("expected task t1 of list1, got %s/%s", fake.lastTasklist, fake.lastTaskID)
+	}
+	if !strings.Contains(text, "Buy milk") || !strings.Contains(text, "Notes: 2 litres") {
+		t.Errorf("unexpected text:\n%s", text)
+	}
+}
+
+func TestHandleResourcesRead_NotFound(t *testing.T) {
+	s := newTestServer(&fakeTasks{err: errors.New("not found")})
+
+	for _, uri := range []string{"gtasks://lists/missing", "file:///etc/passwd"} {
+		resp := s.handleRequest(context.Background(), resourceRequest("resources/read", uri))
+		if resp.Error == nil || resp.Error.Code != errResourceNotFound {
+			t.Errorf("%s: expected resource not found, got %+v", uri, resp.Error)
+		}
+	}
+}
+
+func TestHandleResourcesRead_MissingURI(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+
+	resp := s.handleRequest(context.Background(), JSONRPCRequest{JSONRPC: "2.0", ID: float64(1), Method: "resources/read", Params: json.RawMessage(`{}`)})
+	if resp.Error == nil || resp.Error.Code != -32602 {
+		t.Errorf("expected invalid params, got %+v", resp.Error)
+	}
+}
+
+func TestResourceSubscription_NotifiesOnChange(t *testing.T) {
+	fake := &fakeTasks{taskItems: []TaskItem{{ID: "t1", Title: "First", Status: "needsAction"}}}
+	s := newTestServer(fake)
+	n := &recordingNotifier{}
+	ctx := withNotifier(context.Background(), n)
+	uri := taskListURI("list1")
+
+	resp := s.handleRequest(ctx, resourceRequest("resources/subscribe", uri))
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %+v", resp.Error)
+	}
+
+	s.pollResources(context.Background())
+	if n.count() != 0 {
+		t.Fatalf("expected no notification for unchanged resource, got %d", n.count())
+	}
+
+	fake.taskItems = append(fake.taskItems, TaskItem{ID: "t2", Title: "Second", Status: "needsAction"})
+	s.pollResources(context.Background())
+	if n.count() != 1 {
+		t.Fatalf("expected 1 notification after change, got %d", n.count())
+	}
+	msg := n.msgs[0]
+	if msg["method"] != "notifications/resources/updated" || msg["params"].(map[string]string)["uri"] != uri {
+		t.Errorf("unexpected notification: %v", msg)
+	}
+
+	s.pollResources(context.Background())
+	if n.count() != 1 {
+		t.Errorf("expected no repeat notification, got %d", n.count())
+	}
+
+	s.handleRequest(ctx, resourceRequest("resources/unsubscribe", uri))
+	fake.taskItems = nil
+	s.pollResources(context.Background())
+	if n.count() != 1 {
+		t.Errorf("expected no notification after unsubscribe, got %d", n.count())
+	}
+	if len(s.subs) != 0 {
+		t.Errorf("expected subscription to be removed, got %v", s.subs)
+	}
+}
+
+func TestResourceSubscription_UnsubscribeAll(t *testing.T) {
+	fake := &fakeTasks{task: &tasks.Task{Id: "t1", Title: "Task"}}
+	s := newTestServer(fake)
+	a, b := &recordingNotifier{}, &recordingNotifier{}
+
+	s.handleRequest(withNotifier(context.Background(), a), resourceRequest("resources/subscribe", "gtasks://lists/list1"))
+	s.handleRequest(withNotifier(context.Background(), a), resourceRequest("resources/subscribe", "gtasks://lists/list1/tasks/t1"))
+	s.handleRequest(withNotifier(context.Background(), b), resourceRequest("resources/subscribe", "gtasks://lists/list1"))
+
+	s.unsubscribeAll(a)
+	if len(s.subs) != 1 || !s.subs["gtasks://lists/list1"].notifiers[b] {
+		t.Errorf("expected only b's subscription to remain, got %v", s.subs)
+	}
+}
+
+func TestResourceSubscription_RequiresNotifier(t *testing.T) {
+	s := newTestServer(&fakeTasks{})
+
+	resp := s.handleRequest(context.Background(), resourceRequest("resources/subscribe", "gtasks://lists/list1"))
+	if resp.Error == nil {
+		t.Error("expected error without a notifier")
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// retryMaxAttempts bounds how often one API request is sent
+	retryMaxAttempts = 5
+
+	// retryBaseDelay and retryMaxDelay bound the exponential backoff
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 8 * time.Second
+
+	// retryBudget caps the time spent retrying a request whose context has no
+	// deadline; a nearer deadline shrinks it
+	retryBudget = 30 * time.Second
+)
+
+// retryTransport resends Google API requests that failed with a rate limit,
+// a server error or a network error, backing off exponentially with jitter
+// and honoring Retry-After.
+//
+// Only idempotent requests are retried after errors that may have left the
+// request applied. Inserts, which would create duplicates, are only retried
+// when Google rejected them for rate limiting.
+type retryTransport struct {
+	base http.RoundTripper
+
+	// sleep waits between attempts; tests replace it to skip the wait
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newRetryTransport(base http.RoundTripper) *retryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &retryTransport{base: base, sleep: sleepContext}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	deadline := time.Now().Add(retryBudget)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt == retryMaxAttempts || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		delay := backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = after
+			}
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return resp, err
+		}
+
+		// The request is sent again, so its body has to be replayable
+		next := req
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return resp, err
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return resp, err
+			}
+			next = req.Clone(ctx)
+			next.Body = body
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+		if err := t.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+		req = next
+	}
+}
+
+// shouldRetry reports whether a failed attempt is worth repeating.
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		// A refused token refresh won't succeed on the next attempt either,
+		// and each attempt reloads the token store and refreshes again
+		var retrieveErr *oauth2.RetrieveError
+		if errors.Is(err, errReauthRequired) || errors.As(err, &retrieveErr) {
+			return false
+		}
+		// A cancelled request stays cancelled; other errors may be transient,
+		// but the request may have reached Google before the connection broke
+		return req.Context().Err() == nil && idempotent(req)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		return isRateLimited(resp)
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent(req)
+	}
+	return false
+}
+
+// idempotent reports whether sending req twice has the same effect as once.
+// Every Tasks API POST is idempotent except the inserts, which end in
+// /lists (new task list) or /tasks (new task).
+func idempotent(req *http.Request) bool {
+	if req.Method != http.MethodPost {
+		return true
+	}
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	return !strings.HasSuffix(path, "/lists") && !strings.HasSuffix(path, "/tasks")
+}
+
+// isRateLimited reports whether a 403 is Google's per-user rate limit rather
+// than a permission error. The body is left readable.
+func isRateLimited(resp *http.Response) bool {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	// Covers both rateLimitExceeded and userRateLimitExceeded
+	return bytes.Contains(bytes.ToLower(body), []byte("ratelimitexceeded"))
+}
+
+// backoff returns a jittered delay between half and all of the exponential
+// bound for an attempt.
+func backoff(attempt int) time.Duration {
+	bound := retryBaseDelay << (attempt - 1)
+	if bound > retryMaxDelay || bound <= 0 {
+		bound = retryMaxDelay
+	}
+	return bound/2 + rand.N(bound/2)
+}
+
+// retryAfter parses a Retry-After header, given in seconds or as an HTTP date.
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
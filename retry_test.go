@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/api/tasks/v1"
+)
+
+// scriptedAPI is a stand-in Tasks API that answers with scripted statuses
+// before succeeding, and records what it was sent.
+type scriptedAPI struct {
+	mu       sync.Mutex
+	statuses []int
+	headers  map[string]string
+	errBody  string
+	requests []string
+	bodies   []string
+}
+
+func (a *scriptedAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	a.requests = append(a.requests, r.Method+" "+r.URL.Path)
+	a.bodies = append(a.bodies, string(body))
+
+	if len(a.statuses) > 0 {
+		status := a.statuses[0]
+		a.statuses = a.statuses[1:]
+		for k, v := range a.headers {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, a.errBody)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&tasks.Task{Id: "t1", Title: "Task", Status: "needsAction"})
+}
+
+func (a *scriptedAPI) sent() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string{}, a.requests...)
+}
+
+// newRetryingTasksClient returns a TasksClient that retries against api and
+// the delays it waited.
+func newRetryingTasksClient(t *testing.T, api http.Handler) (*TasksClient, *[]time.Duration) {
+	t.Helper()
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	var delays []time.Duration
+	transport := newRetryTransport(srv.Client().Transport)
+	transport.sleep = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+
+	service, err := tasks.NewService(context.Background(),
+		option.WithHTTPClient(&http.Client{Transport: transport}),
+		option.WithEndpoint(srv.URL+"/"),
+	)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	return &TasksClient{service: service, loc: time.UTC}, &delays
+}
+
+func TestRetry_TransientErrors(t *testing.T) {
+	api := &scriptedAPI{statuses: []int{503, 500, 429}}
+	c, delays := newRetryingTasksClient(t, api)
+
+	task, err := c.GetTask(context.Background(), "list1", "t1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if task.Id != "t1" {
+		t.Errorf("unexpected task: %+v", task)
+	}
+	if len(api.sent()) != 4 {
+		t.Errorf("expected 4 attempts, got %v", api.sent())
+	}
+
+	// Jittered exponential backoff: each delay within [bound/2, bound)
+	for i, d := range *delays {
+		bound := retryBaseDelay << i
+		if d < bound/2 || d >= bound {
+			t.Errorf("delay %d: %v outside [%v, %v)", i, d, bound/2, bound)
+		}
+	}
+}
+
+func TestRetry_GivesUpAfterMaxAttempts(t *testing.T) {
+	api := &scriptedAPI{statuses: []int{503, 503, 503, 503, 503, 503, 503}}
+	c, _ := newRetryingTasksClient(t, api)
+
+	_, err := c.GetTask(context.Background(), "list1", "t1")
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != 503 {
+		t.Fatalf("expected the last 503 to surface, got %v", err)
+	}
+	if len(api.sent()) != retryMaxAttempts {
+		t.Errorf("expected %d attempts, got %d", retryMaxAttempts, len(api.sent()))
+	}
+}
+
+func TestRetry_HonorsRetryAfter(t *testing.T) {
+	api := &scriptedAPI{statuses: []int{429}, headers: map[string]string{"Retry-After": "3"}}
+	c, delays := newRetryingTasksClient(t, api)
+
+	if _, err := c.GetTask(context.Background(), "list1", "t1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*delays) != 1 || (*delays)[0] != 3*time.Second {
+		t.Errorf("expected to wait 3s as told, got %v", *delays)
+	}
+}
+
+func TestRetry_RateLimited403(t *testing.T) {
+	api := &scriptedAPI{
+		statuses: []int{403},
+		errBody:  `{"error":{"code":403,"errors":[{"reason":"userRateLimitExceeded"}]}}`,
+	}
+	c, _ := newRetryingTasksClient(t, api)
+
+	if _, err := c.GetTask(context.Background(), "list1", "t1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(api.sent()) != 2 {
+		t.Errorf("expected a retry after the rate limit, got %v", api.sent())
+	}
+}
+
+func TestRetry_Forbidden403NotRetried(t *testing.T) {
+	api := &scriptedAPI{
+		statuses: []int{403},
+		errBody:  `{"error":{"code":403,"message":"Insufficient Permission","errors":[{"reason":"insufficientPermissions"}]}}`,
+	}
+	c, _ := newRetryingTasksClient(t, api)
+
+	_, err := c.GetTask(context.Background(), "list1", "t1")
+	if err == nil || !strings.Contains(err.Error(), "Insufficient Permission") {
+		t.Errorf("expected the permission error with its message, got %v", err)
+	}
+	if len(api.sent()) != 1 {
+		t.Errorf("expected no retry, got %v", api.sent())
+	}
+}
+
+func TestRetry_InsertOnlyRetriedWhenRateLimited(t *testing.T) {
+	api := &scriptedAPI{statuses: []int{503}}
+	c, _ := newRetryingTasksClient(t, api)
+
+	if _, err := c.CreateTask(context.Background(), "list1", "Buy milk", "", "", ""); err == nil {
+		t.Fatal("expected the 503 to surface")
+	}
+	if len(api.sent()) != 1 {
+		t.Errorf("expected insert not to be retried after a 503, got %v", api.sent())
+	}
+
+	api = &scriptedAPI{statuses: []int{429}}
+	c, _ = newRetryingTasksClient(t, api)
+
+	if _, err := c.CreateTask(context.Background(), "list1", "Buy milk", "", "", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sent := api.sent()
+	if len(sent) != 2 || sent[1] != "POST /tasks/v1/lists/list1/tasks" {
+		t.Errorf("expected insert to be retried after a 429, got %v", sent)
+	}
+	if api.bodies[0] != api.bodies[1] || !strings.Contains(api.bodies[1], "Buy milk") {
+		t.Errorf("expected the same body to be sent again, got %q", api.bodies)
+	}
+}
+
+func TestRetry_IdempotentPostRetried(t *testing.T) {
+	api := &scriptedAPI{statuses: []int{502}}
+	c, _ := newRetryingTasksClient(t, api)
+
+	if _, err := c.MoveTask(context.Background(), "list1", "t1", "", "", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(api.sent()) != 2 {
+		t.Errorf("expected move to be retried, got %v", api.sent())
+	}
+}
+
+func TestRetry_StopsAtContextDeadline(t *testing.T) {
+	api := &scriptedAPI{statuses: []int{429}, headers: map[string]string{"Retry-After": "60"}}
+	c, delays := newRetryingTasksClient(t, api)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := c.GetTask(ctx, "list1", "t1")
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != 429 {
+		t.Fatalf("expected the 429 to surface, got %v", err)
+	}
+	if len(*delays) != 0 || len(api.sent()) != 1 {
+		t.Errorf("expected no wait past the deadline, got delays %v", *delays)
+	}
+}
+
+func TestRetry_NetworkErrors(t *testing.T) {
+	failing := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection reset by peer")
+	})
+
+	for _, tt := range []struct {
+		method, path string
+		attempts     int
+	}{
+		{http.MethodGet, "/tasks/v1/lists/list1/tasks/t1", retryMaxAttempts},
+		{http.MethodPost, "/tasks/v1/lists/list1/tasks", 1},
+	} {
+		attempts := 0
+		transport := newRetryTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			attempts++
+			return failing(r)
+		}))
+		transport.sleep = func(context.Context, time.Duration) error { return nil }
+
+		req, _ := http.NewRequest(tt.method, "https://tasks.googleapis.com"+tt.path, strings.NewReader("{}"))
+		if _, err := transport.RoundTrip(req); err == nil {
+			t.Errorf("%s %s: expected error", tt.method, tt.path)
+		}
+		if attempts != tt.attempts {
+			t.Errorf("%s %s: expected %d attempts, got %d", tt.method, tt.path, tt.attempts, attempts)
+		}
+	}
+}
+
+func TestRetry_AuthErrorsNotRetried(t *testing.T) {
+	for name, tokenErr := range map[string]error{
+		"reauth required": fmt.Errorf("%w: invalid_grant", errReauthRequired),
+		"refresh refused": &oauth2.RetrieveError{ErrorCode: "invalid_client"},
+	} {
+		refreshes := 0
+		source := tokenSourceFunc(func() (*oauth2.Token, error) {
+			refreshes++
+			return nil, tokenErr
+		})
+		sent := 0
+		transport := newRetryTransport(&oauth2.Transport{
+			Source: source,
+			Base: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				sent++
+				return nil, errors.New("unexpected request")
+			}),
+		})
+		transport.sleep = func(context.Context, time.Duration) error { return nil }
+
+		req, _ := http.NewRequest(http.MethodGet, "https://tasks.googleapis.com/tasks/v1/lists/list1/tasks/t1", nil)
+		if _, err := transport.RoundTrip(req); !errors.Is(err, tokenErr) {
+			t.Errorf("%s: expected the token error, got %v", name, err)
+		}
+		if refreshes != 1 || sent != 0 {
+			t.Errorf("%s: expected a single attempt, got %d refreshes and %d requests", name, refreshes, sent)
+		}
+	}
+}
+
+type tokenSourceFunc func() (*oauth2.Token, error)
+
+func (f tokenSourceFunc) Token() (*oauth2.Token, error) {
+	return f()
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestRetryAfter(t *testing.T) {
+	if d, ok := retryAfter("7"); !ok || d != 7*time.Second {
+		t.Errorf("expected 7s, got %v %v", d, ok)
+	}
+	if d, ok := retryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); !ok || d < 58*time.Second || d > time.Minute {
+		t.Errorf("expected about a minute, got %v %v", d, ok)
+	}
+	if _, ok := retryAfter("soon"); ok {
+		t.Error("expected invalid Retry-After to be ignored")
+	}
+}
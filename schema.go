@@ -0,0 +1,134 @@
+package main
+
+import "sort"
+
+// Output schemas for the structuredContent returned by each tool.
+
+var taskItemSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"id":        map[string]interface{}{"type": "string"},
+		"title":     map[string]interface{}{"type": "string"},
+		"notes":     map[string]interface{}{"type": "string"},
+		"due":       map[string]interface{}{"type": "string", "description": "RFC3339 due date"},
+		"status":    map[string]interface{}{"type": "string", "enum": []string{"needsAction", "completed"}},
+		"completed": map[string]interface{}{"type": "string", "description": "RFC3339 completion time"},
+		"parent":    map[string]interface{}{"type": "string", "description": "Parent task ID for subtasks"},
+		"position":  map[string]interface{}{"type": "string", "description": "Sort key among sibling tasks"},
+		"etag":      map[string]interface{}{"type": "string", "description": "Version of the task, for update_task's etag"},
+	},
+	"required": []string{"id", "title", "status"},
+}
+
+var taskListItemSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"id":    map[string]interface{}{"type": "string"},
+		"title": map[string]interface{}{"type": "string"},
+	},
+	"required": []string{"id", "title"},
+}
+
+// objectSchema returns an object schema whose properties are all required.
+func objectSchema(properties map[string]interface{}) map[string]interface{} {
+	required := make([]string, 0, len(properties))
+	for name := range properties {
+		required = append(required, name)
+	}
+	sort.Strings(required)
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+func arrayOf(items map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "array", "items": items}
+}
+
+var (
+	taskOutputSchema = objectSchema(map[string]interface{}{
+		"task": taskItemSchema,
+	})
+
+	taskListOutputSchema = objectSchema(map[string]interface{}{
+		"task_list": taskListItemSchema,
+	})
+
+	// reopenOutputSchema describes tools that may reopen a completed task
+	reopenOutputSchema = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"task":                 taskItemSchema,
+			"previously_completed": map[string]interface{}{"type": "string", "description": "RFC3339 completion time that was cleared"},
+		},
+		"required": []string{"task"},
+	}
+
+	deletedOutputSchema = objectSchema(map[string]interface{}{
+		"deleted": map[string]interface{}{"type": "boolean"},
+		"id":      map[string]interface{}{"type": "string"},
+	})
+)
+
+// outputSchemas maps tool names to the schema of their structuredContent.
+var outputSchemas = map[string]map[string]interface{}{
+	toolListAccounts: objectSchema(map[string]interface{}{
+		"accounts": arrayOf(objectSchema(map[string]interface{}{
+			"name":    map[string]interface{}{"type": "string"},
+			"default": map[string]interface{}{"type": "boolean"},
+		})),
+	}),
+	toolListTaskLists: objectSchema(map[string]interface{}{
+		"task_lists": arrayOf(taskListItemSchema),
+	}),
+	toolCreateTaskList: taskListOutputSchema,
+	toolUpdateTaskList: taskListOutputSchema,
+	toolDeleteTaskList: deletedOutputSchema,
+	toolListTasks: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"tasks":           arrayOf(taskItemSchema),
+			"next_page_token": map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"tasks"},
+	},
+	toolSearchTasks: objectSchema(map[string]interface{}{
+		"total": map[string]interface{}{"type": "integer"},
+		"results": arrayOf(objectSchema(map[string]interface{}{
+			"task_list": taskListItemSchema,
+			"tasks":     arrayOf(taskItemSchema),
+		})),
+	}),
+	toolCreateTask:   taskOutputSchema,
+	toolUpdateTask:   reopenOutputSchema,
+	toolCompleteTask: taskOutputSchema,
+	toolReopenTask:   reopenOutputSchema,
+	toolDeleteTask:   deletedOutputSchema,
+	toolMoveTask: objectSchema(map[string]interface{}{
+		"task":        taskItemSchema,
+		"tasklist_id": map[string]interface{}{"type": "string"},
+	}),
+	toolClearCompleted: objectSchema(map[string]interface{}{
+		"cleared":     map[string]interface{}{"type": "integer"},
+		"tasklist_id": map[string]interface{}{"type": "string"},
+	}),
+	toolBatch: objectSchema(map[string]interface{}{
+		"succeeded":   map[string]interface{}{"type": "integer"},
+		"failed":      map[string]interface{}{"type": "integer"},
+		"skipped":     map[string]interface{}{"type": "integer"},
+		"rolled_back": map[string]interface{}{"type": "integer"},
+		"results": arrayOf(map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"index":  map[string]interface{}{"type": "integer"},
+				"op":     map[string]interface{}{"type": "string", "enum": batchOpNames()},
+				"status": map[string]interface{}{"type": "string", "enum": []string{batchSucceeded, batchFailed, batchSkipped, batchRolledBack}},
+				"result": map[string]interface{}{"type": "object", "description": "Structured output of the tool the operation ran"},
+				"error":  map[string]interface{}{"type": "string"},
+			},
+			"required": []string{"index", "op", "status"},
+		}),
+	}),
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 	"google.golang.org/api/tasks/v1"
 )
@@ -22,6 +24,9 @@ type TaskItem struct {
 	Due       string `json:"due,omitempty"`
 	Status    string `json:"status"`
 	Completed string `json:"completed,omitempty"`
+	Parent    string `json:"parent,omitempty"`
+	Position  string `json:"position,omitempty"`
+	ETag      string `json:"etag,omitempty"`
 }
 
 type TaskListItem struct {
@@ -29,11 +34,24 @@ type TaskListItem struct {
 	Title string `json:"title"`
 }
 
-// NewTasksClientOAuth creates a client using OAuth2 token
+// TaskPage is one page of tasks plus the token to fetch the next one
+type TaskPage struct {
+	Items         []TaskItem `json:"items"`
+	NextPageToken string     `json:"next_page_token,omitempty"`
+}
+
+// maxPageSize is the largest page the Tasks API will return
+const maxPageSize = 100
+
+// NewTasksClientOAuth creates a client using OAuth2 token. Requests that fail
+// transiently are retried, see retryTransport.
 func NewTasksClientOAuth(httpClient *http.Client, loc *time.Location) (*TasksClient, error) {
 	ctx := context.Background()
 
-	srv, err := tasks.NewService(ctx, option.WithHTTPClient(httpClient))
+	retrying := *httpClient
+	retrying.Transport = newRetryTransport(httpClient.Transport)
+
+	srv, err := tasks.NewService(ctx, option.WithHTTPClient(&retrying))
 	if err != nil {
 		return nil, err
 	}
@@ -58,6 +76,26 @@ func parseDue(due string, loc *time.Location) (string, error) {
 	return "", fmt.Errorf("invalid due format %q, expected YYYY-MM-DD or YYYY-MM-DDTHH:MM", due)
 }
 
+// dueDate returns the start of date (YYYY-MM-DD) as Google stores due dates:
+// midnight UTC, whatever the configured timezone.
+func dueDate(date string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+	}
+	return t, nil
+}
+
+// dayAfter returns the start of the day following date (YYYY-MM-DD) as RFC3339,
+// for use as an exclusive upper bound that still includes date itself.
+func dayAfter(date string) (string, error) {
+	t, err := dueDate(date)
+	if err != nil {
+		return "", err
+	}
+	return t.AddDate(0, 0, 1).Format(time.RFC3339), nil
+}
+
 // formatDue converts RFC3339 from Google API to a human-readable string in the configured timezone.
 func formatDue(rfc3339 string, loc *time.Location) string {
 	if loc == nil {
@@ -78,57 +116,163 @@ func formatDue(rfc3339 string, loc *time.Location) string {
 	return t.Format("2006-01-02 15:04")
 }
 
-// ListTaskLists returns all task lists
+// ListTaskLists returns all task lists, following pagination to the end
 func (c *TasksClient) ListTaskLists(ctx context.Context) ([]TaskListItem, error) {
-	lists, err := c.service.Tasklists.List().Context(ctx).Do()
+	result := make([]TaskListItem, 0)
+	err := c.service.Tasklists.List().
+		MaxResults(maxPageSize).
+		Pages(ctx, func(lists *tasks.TaskLists) error {
+			for _, l := range lists.Items {
+				result = append(result, newTaskListItem(l))
+			}
+			return nil
+		})
 	if err != nil {
 		return nil, err
 	}
 
-	result := make([]TaskListItem, 0, len(lists.Items))
-	for _, l := range lists.Items {
-		result = append(result, TaskListItem{
-			ID:    l.Id,
-			Title: l.Title,
-		})
-	}
-
 	return result, nil
 }
 
-// ListTasks returns tasks from a specific task list
+// GetTaskList returns a task list; "@default" returns the user's default list
+func (c *TasksClient) GetTaskList(ctx context.Context, tasklistID string) (*tasks.TaskList, error) {
+	return c.service.Tasklists.Get(tasklistID).Context(ctx).Do()
+}
+
+// CreateTaskList creates a new task list
+func (c *TasksClient) CreateTaskList(ctx context.Context, title string) (*tasks.TaskList, error) {
+	return c.service.Tasklists.Insert(&tasks.TaskList{Title: title}).Context(ctx).Do()
+}
+
+// UpdateTaskList renames a task list
+func (c *TasksClient) UpdateTaskList(ctx context.Context, tasklistID, title string) (*tasks.TaskList, error) {
+	return c.service.Tasklists.Patch(tasklistID, &tasks.TaskList{Title: title}).Context(ctx).Do()
+}
+
+// DeleteTaskList deletes a task list together with all of its tasks
+func (c *TasksClient) DeleteTaskList(ctx context.Context, tasklistID string) error {
+	return c.service.Tasklists.Delete(tasklistID).Context(ctx).Do()
+}
+
+// ListTasks returns all tasks from a specific task list
 func (c *TasksClient) ListTasks(ctx context.Context, tasklistID string, showCompleted bool) ([]TaskItem, error) {
-	call := c.service.Tasks.List(tasklistID).
-		MaxResults(100).
-		ShowCompleted(showCompleted).
-		ShowHidden(false)
+	page, err := c.ListTasksPage(ctx, tasklistID, showCompleted, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	return page.Items, nil
+}
+
+// TaskFilter narrows the tasks returned by the Tasks API
+type TaskFilter struct {
+	ShowCompleted bool
+	ShowHidden    bool
+	DueMin        string // RFC3339, inclusive
+	DueMax        string // RFC3339, exclusive
+}
+
+// ListTasksPage returns up to limit tasks starting at pageToken.
+// A limit of 0 fetches every remaining page.
+func (c *TasksClient) ListTasksPage(ctx context.Context, tasklistID string, showCompleted bool, pageToken string, limit int) (*TaskPage, error) {
+	return c.listTasks(ctx, tasklistID, TaskFilter{ShowCompleted: showCompleted}, pageToken, limit)
+}
 
-	taskList, err := call.Context(ctx).Do()
+// FilterTasks returns all tasks from a task list that match filter
+func (c *TasksClient) FilterTasks(ctx context.Context, tasklistID string, filter TaskFilter) ([]TaskItem, error) {
+	page, err := c.listTasks(ctx, tasklistID, filter, "", 0)
 	if err != nil {
 		return nil, err
 	}
+	return page.Items, nil
+}
+
+// HasTasks reports whether a task list holds any task, including completed
+// and hidden ones
+func (c *TasksClient) HasTasks(ctx context.Context, tasklistID string) (bool, error) {
+	page, err := c.listTasks(ctx, tasklistID, TaskFilter{ShowCompleted: true, ShowHidden: true}, "", 1)
+	if err != nil {
+		return false, err
+	}
+	return len(page.Items) > 0, nil
+}
+
+func (c *TasksClient) listTasks(ctx context.Context, tasklistID string, filter TaskFilter, pageToken string, limit int) (*TaskPage, error) {
+	page := &TaskPage{Items: make([]TaskItem, 0)}
+	token := pageToken
 
-	result := make([]TaskItem, 0, len(taskList.Items))
-	for _, t := range taskList.Items {
-		completed := ""
-		if t.Completed != nil {
-			completed = *t.Completed
+	for {
+		size := maxPageSize
+		if limit > 0 && limit-len(page.Items) < size {
+			size = limit - len(page.Items)
+		}
+
+		call := c.service.Tasks.List(tasklistID).
+			MaxResults(int64(size)).
+			ShowCompleted(filter.ShowCompleted).
+			ShowHidden(filter.ShowHidden)
+		if filter.DueMin != "" {
+			call = call.DueMin(filter.DueMin)
+		}
+		if filter.DueMax != "" {
+			call = call.DueMax(filter.DueMax)
+		}
+		if token != "" {
+			call = call.PageToken(token)
+		}
+
+		taskList, err := call.Context(ctx).Do()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range taskList.Items {
+			page.Items = append(page.Items, newTaskItem(t))
+		}
+
+		token = taskList.NextPageToken
+		if token == "" || (limit > 0 && len(page.Items) >= limit) {
+			break
 		}
-		result = append(result, TaskItem{
-			ID:        t.Id,
-			Title:     t.Title,
-			Notes:     t.Notes,
-			Due:       t.Due,
-			Status:    t.Status,
-			Completed: completed,
-		})
 	}
 
-	return result, nil
+	page.NextPageToken = token
+	return page, nil
+}
+
+// newTaskListItem converts an API task list into a TaskListItem
+func newTaskListItem(l *tasks.TaskList) TaskListItem {
+	return TaskListItem{
+		ID:    l.Id,
+		Title: l.Title,
+	}
+}
+
+// newTaskItem converts an API task into a TaskItem
+func newTaskItem(t *tasks.Task) TaskItem {
+	completed := ""
+	if t.Completed != nil {
+		completed = *t.Completed
+	}
+	return TaskItem{
+		ID:        t.Id,
+		Title:     t.Title,
+		Notes:     t.Notes,
+		Due:       t.Due,
+		Status:    t.Status,
+		Completed: completed,
+		Parent:    t.Parent,
+		Position:  t.Position,
+		ETag:      t.Etag,
+	}
+}
+
+// GetTask returns a single task
+func (c *TasksClient) GetTask(ctx context.Context, tasklistID, taskID string) (*tasks.Task, error) {
+	return c.service.Tasks.Get(tasklistID, taskID).Context(ctx).Do()
 }
 
-// CreateTask creates a new task in the specified task list
-func (c *TasksClient) CreateTask(ctx context.Context, tasklistID, title, notes, due string) (*tasks.Task, error) {
+// CreateTask creates a new task in the specified task list, optionally as a subtask of parentID
+func (c *TasksClient) CreateTask(ctx context.Context, tasklistID, title, notes, due, parentID string) (*tasks.Task, error) {
 	task := &tasks.Task{
 		Title: title,
 		Notes: notes,
@@ -142,7 +286,12 @@ func (c *TasksClient) CreateTask(ctx context.Context, tasklistID, title, notes,
 		task.Due = parsed
 	}
 
-	return c.service.Tasks.Insert(tasklistID, task).Context(ctx).Do()
+	call := c.service.Tasks.Insert(tasklistID, task)
+	if parentID != "" {
+		call = call.Parent(parentID)
+	}
+
+	return call.Context(ctx).Do()
 }
 
 // TaskUpdates contains optional fields to update
@@ -151,45 +300,182 @@ type TaskUpdates struct {
 	Notes  *string
 	Due    *string
 	Status *string
+
+	// ETag, when set, is the version of the task the updates are based on;
+	// the update fails with a ConflictError if the task has changed since
+	ETag string
 }
 
-// UpdateTask updates an existing task
+// maxUpdateConflicts bounds how often a full update re-applies updates onto
+// a task that keeps changing underneath it
+const maxUpdateConflicts = 3
+
+// ConflictError reports that a task changed since the version an update was based on.
+type ConflictError struct {
+	// Current is the task as stored now, Proposed is Current with the updates applied
+	Current  *tasks.Task
+	Proposed *tasks.Task
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("task %s was changed by someone else (it now has etag %s)", e.Current.Id, e.Current.Etag)
+}
+
+// UpdateTask sends only the fields set in updates as a patch, so edits made
+// elsewhere to other fields are kept. With updates.ETag set, the patch only
+// applies if the task is unchanged since that version.
 func (c *TasksClient) UpdateTask(ctx context.Context, tasklistID, taskID string, updates TaskUpdates) (*tasks.Task, error) {
-	// Get existing task
-	existing, err := c.service.Tasks.Get(tasklistID, taskID).Context(ctx).Do()
+	patch, err := c.patchFor(updates)
 	if err != nil {
 		return nil, err
 	}
 
-	// Apply updates
+	call := c.service.Tasks.Patch(tasklistID, taskID, patch)
+	if updates.ETag != "" {
+		call.Header().Set("If-Match", updates.ETag)
+	}
+	task, err := call.Context(ctx).Do()
+	if isPreconditionFailed(err) {
+		return nil, c.conflictAfter(ctx, tasklistID, taskID, updates, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A field the updates cleared that is still set didn't take as a null in
+	// the patch; write the whole task instead, based on the patched version
+	if (updates.Due != nil && *updates.Due == "" && task.Due != "") ||
+		(updates.Notes != nil && *updates.Notes == "" && task.Notes != "") ||
+		(updates.Status != nil && *updates.Status != "completed" && task.Completed != nil) {
+		updates.ETag = task.Etag
+		return c.updateFull(ctx, tasklistID, taskID, updates)
+	}
+	return task, nil
+}
+
+// patchFor returns a patch setting the fields that updates change. Cleared
+// fields are sent as nulls.
+func (c *TasksClient) patchFor(updates TaskUpdates) (*tasks.Task, error) {
+	patch := &tasks.Task{}
 	if updates.Title != nil {
-		existing.Title = *updates.Title
+		patch.Title = *updates.Title
+		patch.ForceSendFields = append(patch.ForceSendFields, "Title")
 	}
 	if updates.Notes != nil {
-		existing.Notes = *updates.Notes
+		if *updates.Notes == "" {
+			patch.NullFields = append(patch.NullFields, "Notes")
+		} else {
+			patch.Notes = *updates.Notes
+		}
 	}
 	if updates.Due != nil {
 		if *updates.Due == "" {
-			existing.Due = ""
+			patch.NullFields = append(patch.NullFields, "Due")
 		} else {
 			parsed, err := parseDue(*updates.Due, c.loc)
 			if err != nil {
 				return nil, err
 			}
-			existing.Due = parsed
+			patch.Due = parsed
 		}
 	}
 	if updates.Status != nil {
-		existing.Status = *updates.Status
+		patch.Status = *updates.Status
 		if *updates.Status == "completed" {
 			completedTime := time.Now().UTC().Format(time.RFC3339)
-			existing.Completed = &completedTime
+			patch.Completed = &completedTime
 		} else {
-			existing.Completed = nil
+			patch.NullFields = append(patch.NullFields, "Completed")
 		}
 	}
+	return patch, nil
+}
 
-	return c.service.Tasks.Update(tasklistID, taskID, existing).Context(ctx).Do()
+// updateFull writes back the whole task with updates applied. The task is
+// written only if it is unchanged since it was read; if it changed in
+// between, the updates are re-applied to the fresh copy, unless updates.ETag
+// pins the version they were based on.
+func (c *TasksClient) updateFull(ctx context.Context, tasklistID, taskID string, updates TaskUpdates) (*tasks.Task, error) {
+	for attempt := 1; ; attempt++ {
+		existing, err := c.service.Tasks.Get(tasklistID, taskID).Context(ctx).Do()
+		if err != nil {
+			return nil, err
+		}
+
+		// Invalid updates are reported as such, whether or not the task changed
+		proposed := *existing
+		if err := c.applyUpdates(&proposed, updates); err != nil {
+			return nil, err
+		}
+		if updates.ETag != "" && existing.Etag != updates.ETag {
+			return nil, &ConflictError{Current: existing, Proposed: &proposed}
+		}
+
+		call := c.service.Tasks.Update(tasklistID, taskID, &proposed)
+		if existing.Etag != "" {
+			call.Header().Set("If-Match", existing.Etag)
+		}
+		task, err := call.Context(ctx).Do()
+		if !isPreconditionFailed(err) {
+			return task, err
+		}
+
+		if updates.ETag != "" || attempt == maxUpdateConflicts {
+			return nil, c.conflictAfter(ctx, tasklistID, taskID, updates, err)
+		}
+	}
+}
+
+// isPreconditionFailed reports whether a write was refused because If-Match
+// named an outdated ETag.
+func isPreconditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
+
+// applyUpdates sets the fields of task that updates change.
+func (c *TasksClient) applyUpdates(task *tasks.Task, updates TaskUpdates) error {
+	if updates.Title != nil {
+		task.Title = *updates.Title
+	}
+	if updates.Notes != nil {
+		task.Notes = *updates.Notes
+	}
+	if updates.Due != nil {
+		if *updates.Due == "" {
+			task.Due = ""
+		} else {
+			parsed, err := parseDue(*updates.Due, c.loc)
+			if err != nil {
+				return err
+			}
+			task.Due = parsed
+		}
+	}
+	if updates.Status != nil {
+		task.Status = *updates.Status
+		if *updates.Status == "completed" {
+			completedTime := time.Now().UTC().Format(time.RFC3339)
+			task.Completed = &completedTime
+		} else {
+			task.Completed = nil
+		}
+	}
+	return nil
+}
+
+// conflictAfter returns a ConflictError for a write that writeErr reports was
+// refused because the task changed, reading the task as it is now.
+func (c *TasksClient) conflictAfter(ctx context.Context, tasklistID, taskID string, updates TaskUpdates, writeErr error) error {
+	current, err := c.service.Tasks.Get(tasklistID, taskID).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("%w; reading the current version failed: %w", writeErr, err)
+	}
+	proposed := *current
+	if err := c.applyUpdates(&proposed, updates); err != nil {
+		return err
+	}
+	return &ConflictError{Current: current, Proposed: &proposed}
 }
 
 // CompleteTask marks a task as completed
@@ -202,3 +488,25 @@ func (c *TasksClient) CompleteTask(ctx context.Context, tasklistID, taskID strin
 func (c *TasksClient) DeleteTask(ctx context.Context, tasklistID, taskID string) error {
 	return c.service.Tasks.Delete(tasklistID, taskID).Context(ctx).Do()
 }
+
+// ClearCompleted hides all completed tasks in a task list
+func (c *TasksClient) ClearCompleted(ctx context.Context, tasklistID string) error {
+	return c.service.Tasks.Clear(tasklistID).Context(ctx).Do()
+}
+
+// MoveTask moves a task under parentID after previousID, optionally into destinationTasklistID.
+// Empty parentID moves the task to the top level; empty previousID moves it to the first position.
+func (c *TasksClient) MoveTask(ctx context.Context, tasklistID, taskID, parentID, previousID, destinationTasklistID string) (*tasks.Task, error) {
+	call := c.service.Tasks.Move(tasklistID, taskID)
+	if parentID != "" {
+		call = call.Parent(parentID)
+	}
+	if previousID != "" {
+		call = call.Previous(previousID)
+	}
+	if destinationTasklistID != "" && destinationTasklistID != tasklistID {
+		call = call.DestinationTasklist(destinationTasklistID)
+	}
+
+	return call.Context(ctx).Do()
+}
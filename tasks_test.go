@@ -1,8 +1,21 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/tasks/v1"
 )
 
 func loadTbilisi(t *testing.T) *time.Location {
@@ -112,3 +125,529 @@ func TestFormatDue_InvalidFallback(t *testing.T) {
 		t.Errorf("expected fallback to raw string, got %q", result)
 	}
 }
+
+// newTestTasksClient returns a TasksClient talking to a local stand-in API.
+func newTestTasksClient(t *testing.T, handler http.HandlerFunc) *TasksClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	service, err := tasks.NewService(context.Background(),
+		option.WithHTTPClient(srv.Client()),
+		option.WithEndpoint(srv.URL+"/"),
+	)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	return &TasksClient{service: service, loc: time.UTC}
+}
+
+// pagedTasksHandler serves tasks t1..tN in pages of at most maxResults.
+func pagedTasksHandler(t *testing.T, total int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("maxResults"))
+		if size <= 0 || size > maxPageSize {
+			t.Errorf("unexpected maxResults %q", r.URL.Query().Get("maxResults"))
+			size = maxPageSize
+		}
+
+		resp := tasks.Tasks{}
+		end := start + size
+		if end > total {
+			end = total
+		}
+		for i := start; i < end; i++ {
+			resp.Items = append(resp.Items, &tasks.Task{Id: fmt.Sprintf("t%d", i+1), Status: "needsAction"})
+		}
+		if end < total {
+			resp.NextPageToken = strconv.Itoa(end)
+		}
+		json.NewEncoder(w).Encode(&resp)
+	}
+}
+
+func TestListTasks_FollowsAllPages(t *testing.T) {
+	c := newTestTasksClient(t, pagedTasksHandler(t, 250))
+
+	items, err := c.ListTasks(context.Background(), "list1", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(items) != 250 {
+		t.Fatalf("expected 250 tasks, got %d", len(items))
+	}
+	if items[249].ID != "t250" {
+		t.Errorf("expected last task t250, got %s", items[249].ID)
+	}
+}
+
+func TestListTasksPage_Limit(t *testing.T) {
+	c := newTestTasksClient(t, pagedTasksHandler(t, 250))
+
+	page, err := c.ListTasksPage(context.Background(), "list1", false, "", 150)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(page.Items) != 150 {
+		t.Fatalf("expected 150 tasks, got %d", len(page.Items))
+	}
+	if page.NextPageToken != "150" {
+		t.Errorf("expected next page token 150, got %q", page.NextPageToken)
+	}
+
+	page, err = c.ListTasksPage(context.Background(), "list1", false, page.NextPageToken, 150)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(page.Items) != 100 || page.Items[0].ID != "t151" {
+		t.Errorf("expected tasks t151..t250, got %d starting at %v", len(page.Items), page.Items)
+	}
+	if page.NextPageToken != "" {
+		t.Errorf("expected no next page token, got %q", page.NextPageToken)
+	}
+}
+
+func TestListTaskLists_FollowsAllPages(t *testing.T) {
+	c := newTestTasksClient(t, func(w http.ResponseWriter, r *http.Request) {
+		resp := tasks.TaskLists{Items: []*tasks.TaskList{{Id: "list2", Title: "Work"}}}
+		if r.URL.Query().Get("pageToken") == "" {
+			resp = tasks.TaskLists{
+				Items:         []*tasks.TaskList{{Id: "list1", Title: "My Tasks"}},
+				NextPageToken: "next",
+			}
+		}
+		json.NewEncoder(w).Encode(&resp)
+	})
+
+	lists, err := c.ListTaskLists(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(lists) != 2 || lists[1].ID != "list2" {
+		t.Errorf("expected both pages of task lists, got %v", lists)
+	}
+}
+
+func TestCreateTask_WithParent(t *testing.T) {
+	var gotParent string
+	c := newTestTasksClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotParent = r.URL.Query().Get("parent")
+		var task tasks.Task
+		json.NewDecoder(r.Body).Decode(&task)
+		task.Id = "new-1"
+		task.Parent = gotParent
+		json.NewEncoder(w).Encode(&task)
+	})
+
+	task, err := c.CreateTask(context.Background(), "list1", "Subtask", "", "", "p1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotParent != "p1" || task.Parent != "p1" {
+		t.Errorf("expected parent p1 to be sent, got %q", gotParent)
+	}
+}
+
+func TestMoveTask_SendsLocation(t *testing.T) {
+	var got url.Values
+	c := newTestTasksClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/lists/inbox/tasks/t1/move") {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		got = r.URL.Query()
+		json.NewEncoder(w).Encode(&tasks.Task{Id: "t1", Parent: "p1"})
+	})
+
+	if _, err := c.MoveTask(context.Background(), "inbox", "t1", "p1", "t0", "work"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Get("parent") != "p1" || got.Get("previous") != "t0" || got.Get("destinationTasklist") != "work" {
+		t.Errorf("unexpected move parameters: %v", got)
+	}
+}
+
+func TestDayAfter(t *testing.T) {
+	// Due dates are stored as midnight UTC, so the bound ignores the timezone
+	result, err := dayAfter("2026-03-31")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != "2026-04-01T00:00:00Z" {
+		t.Errorf("expected 2026-04-01T00:00:00Z, got %q", result)
+	}
+
+	if _, err := dayAfter("2026-03-31T10:00"); err == nil {
+		t.Error("expected error for date with time")
+	}
+}
+
+func TestFilterTasks_SendsDueRange(t *testing.T) {
+	var got url.Values
+	c := newTestTasksClient(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		json.NewEncoder(w).Encode(&tasks.Tasks{})
+	})
+
+	filter := TaskFilter{ShowCompleted: true, ShowHidden: true, DueMin: "2026-03-01T00:00:00Z", DueMax: "2026-04-01T00:00:00Z"}
+	if _, err := c.FilterTasks(context.Background(), "list1", filter); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Get("dueMin") != filter.DueMin || got.Get("dueMax") != filter.DueMax || got.Get("showCompleted") != "true" || got.Get("showHidden") != "true" {
+		t.Errorf("unexpected query parameters: %v", got)
+	}
+}
+
+func TestHasTasks_IncludesHidden(t *testing.T) {
+	var got url.Values
+	c := newTestTasksClient(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		json.NewEncoder(w).Encode(&tasks.Tasks{Items: []*tasks.Task{{Id: "t1", Status: "completed", Hidden: true}}})
+	})
+
+	nonEmpty, err := c.HasTasks(context.Background(), "list1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !nonEmpty {
+		t.Error("expected a list holding a hidden task not to be empty")
+	}
+	if got.Get("showHidden") != "true" || got.Get("showCompleted") != "true" || got.Get("maxResults") != "1" {
+		t.Errorf("unexpected query parameters: %v", got)
+	}
+}
+
+// etagTaskHandler stands in for one task whose ETag changes on every write.
+// Before each write is applied, interfere may change the stored task as
+// another client would.
+type etagTaskHandler struct {
+	t         *testing.T
+	task      tasks.Task
+	version   int
+	interfere func(task *tasks.Task) bool
+
+	// ignoreNulls makes patches skip null fields instead of clearing them
+	ignoreNulls bool
+
+	requests   []string
+	ifMatch    []string
+	bodies     []string
+	conflicted int
+}
+
+func (h *etagTaskHandler) bump() {
+	h.version++
+	h.task.Etag = fmt.Sprintf(`"v%d"`, h.version)
+}
+
+func (h *etagTaskHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.requests = append(h.requests, r.Method)
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(&h.task)
+		return
+	}
+
+	if h.interfere != nil && h.interfere(&h.task) {
+		h.bump()
+	}
+	body, _ := io.ReadAll(r.Body)
+	h.bodies = append(h.bodies, strings.TrimSpace(string(body)))
+	h.ifMatch = append(h.ifMatch, r.Header.Get("If-Match"))
+
+	if match := r.Header.Get("If-Match"); match != "" && match != h.task.Etag {
+		h.conflicted++
+		w.WriteHeader(http.StatusPreconditionFailed)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": 412, "message": "Precondition Failed"}})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var task tasks.Task
+		json.Unmarshal(body, &task)
+		h.task = task
+	case http.MethodPatch:
+		var fields map[string]*string
+		json.Unmarshal(body, &fields)
+		for name, v := range fields {
+			if v == nil && h.ignoreNulls {
+				continue
+			}
+			value := ""
+			if v != nil {
+				value = *v
+			}
+			switch name {
+			case "title":
+				h.task.Title = value
+			case "notes":
+				h.task.Notes = value
+			case "due":
+				h.task.Due = value
+			case "status":
+				h.task.Status = value
+			case "completed":
+				h.task.Completed = v
+			default:
+				h.t.Errorf("unexpected patched field %q", name)
+			}
+		}
+	default:
+		h.t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+	}
+	h.bump()
+	json.NewEncoder(w).Encode(&h.task)
+}
+
+func newETagTaskHandler(t *testing.T) *etagTaskHandler {
+	completed := "2026-03-01T10:00:00.000Z"
+	h := &etagTaskHandler{t: t, task: tasks.Task{
+		Id:        "t1",
+		Title:     "Draft",
+		Notes:     "old notes",
+		Due:       "2026-03-15T00:00:00.000Z",
+		Status:    "completed",
+		Completed: &completed,
+	}}
+	h.bump()
+	return h
+}
+
+func TestUpdateTask_PatchBodies(t *testing.T) {
+	strp := func(s string) *string { return &s }
+
+	tests := []struct {
+		name    string
+		updates TaskUpdates
+		body    string
+	}{
+		{"title", TaskUpdates{Title: strp("Final")}, `{"title":"Final"}`},
+		{"notes and due", TaskUpdates{Notes: strp("new notes"), Due: strp("2026-04-01")}, `{"due":"2026-04-01T00:00:00Z","notes":"new notes"}`},
+		{"clear due", TaskUpdates{Due: strp("")}, `{"due":null}`},
+		{"clear notes", TaskUpdates{Notes: strp("")}, `{"notes":null}`},
+		{"empty title", TaskUpdates{Title: strp("")}, `{"title":""}`},
+		{"reopen", TaskUpdates{Status: strp("needsAction")}, `{"completed":null,"status":"needsAction"}`},
+	}
+
+	for _, tt := range tests {
+		h := newETagTaskHandler(t)
+		c := newTestTasksClient(t, h.ServeHTTP)
+
+		if _, err := c.UpdateTask(context.Background(), "list1", "t1", tt.updates); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if strings.Join(h.requests, ",") != "PATCH" {
+			t.Errorf("%s: expected a single PATCH, got %v", tt.name, h.requests)
+		}
+		if h.bodies[0] != tt.body {
+			t.Errorf("%s: expected body %s, got %s", tt.name, tt.body, h.bodies[0])
+		}
+		if h.ifMatch[0] != "" {
+			t.Errorf("%s: expected no If-Match without an etag, got %q", tt.name, h.ifMatch[0])
+		}
+	}
+}
+
+func TestCompleteTask_Patches(t *testing.T) {
+	h := newETagTaskHandler(t)
+	h.task.Status, h.task.Completed = "needsAction", nil
+	c := newTestTasksClient(t, h.ServeHTTP)
+
+	task, err := c.CompleteTask(context.Background(), "list1", "t1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var body map[string]interface{}
+	json.Unmarshal([]byte(h.bodies[0]), &body)
+	if strings.Join(h.requests, ",") != "PATCH" || len(body) != 2 || body["status"] != "completed" || body["completed"] == nil {
+		t.Errorf("expected a PATCH of status and completed, got %v %s", h.requests, h.bodies)
+	}
+	if task.Status != "completed" || task.Title != "Draft" {
+		t.Errorf("unexpected task: %+v", task)
+	}
+}
+
+func TestUpdateTask_KeepsConcurrentEdits(t *testing.T) {
+	h := newETagTaskHandler(t)
+	h.interfere = func(task *tasks.Task) bool {
+		task.Notes = "edited on the phone"
+		return true
+	}
+	c := newTestTasksClient(t, h.ServeHTTP)
+
+	title := "Final"
+	task, err := c.UpdateTask(context.Background(), "list1", "t1", TaskUpdates{Title: &title})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if task.Title != "Final" || task.Notes != "edited on the phone" {
+		t.Errorf("expected both edits to survive, got %+v", task)
+	}
+}
+
+func TestUpdateTask_SendsIfMatch(t *testing.T) {
+	h := newETagTaskHandler(t)
+	c := newTestTasksClient(t, h.ServeHTTP)
+
+	title := "Final"
+	task, err := c.UpdateTask(context.Background(), "list1", "t1", TaskUpdates{Title: &title, ETag: `"v1"`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(h.ifMatch) != 1 || h.ifMatch[0] != `"v1"` {
+		t.Errorf("expected If-Match with the given ETag, got %q", h.ifMatch)
+	}
+	if task.Title != "Final" || task.Etag != `"v2"` {
+		t.Errorf("unexpected task: %+v", task)
+	}
+}
+
+func TestUpdateTask_StaleETag(t *testing.T) {
+	h := newETagTaskHandler(t)
+	h.task.Notes = "edited on the phone"
+	h.bump()
+	c := newTestTasksClient(t, h.ServeHTTP)
+
+	title := "Final"
+	_, err := c.UpdateTask(context.Background(), "list1", "t1", TaskUpdates{Title: &title, ETag: `"v1"`})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+	if h.conflicted != 1 || h.task.Title != "Draft" {
+		t.Errorf("expected the patch to be refused, got %+v", h.task)
+	}
+	if conflict.Current.Title != "Draft" || conflict.Current.Etag != `"v2"` {
+		t.Errorf("unexpected current version: %+v", conflict.Current)
+	}
+	if conflict.Proposed.Title != "Final" || conflict.Proposed.Notes != "edited on the phone" {
+		t.Errorf("unexpected proposed version: %+v", conflict.Proposed)
+	}
+}
+
+func TestUpdateTask_FallsBackToFullUpdate(t *testing.T) {
+	h := newETagTaskHandler(t)
+	h.ignoreNulls = true
+	c := newTestTasksClient(t, h.ServeHTTP)
+
+	due := ""
+	task, err := c.UpdateTask(context.Background(), "list1", "t1", TaskUpdates{Due: &due})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(h.requests, ",") != "PATCH,GET,PUT" {
+		t.Errorf("expected a full update after the ignored null, got %v", h.requests)
+	}
+	if h.ifMatch[1] != `"v2"` {
+		t.Errorf("expected the full update to be based on the patched version, got If-Match %q", h.ifMatch[1])
+	}
+	if task.Due != "" || task.Title != "Draft" {
+		t.Errorf("expected due date cleared and the rest kept, got %+v", task)
+	}
+}
+
+func TestUpdateFull_ReappliesOnConflict(t *testing.T) {
+	h := newETagTaskHandler(t)
+	h.interfere = func(task *tasks.Task) bool {
+		if len(h.bodies) > 0 {
+			return false
+		}
+		task.Notes = "edited on the phone"
+		return true
+	}
+	c := newTestTasksClient(t, h.ServeHTTP)
+
+	title := "Final"
+	task, err := c.updateFull(context.Background(), "list1", "t1", TaskUpdates{Title: &title})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h.conflicted != 1 || len(h.bodies) != 2 {
+		t.Fatalf("expected one conflict and a second write, got %d conflicts, %d writes", h.conflicted, len(h.bodies))
+	}
+	if h.ifMatch[0] != `"v1"` || h.ifMatch[1] != `"v2"` {
+		t.Errorf("expected each write to be based on a fresh copy, got If-Match %q", h.ifMatch)
+	}
+	if task.Title != "Final" || task.Notes != "edited on the phone" {
+		t.Errorf("expected both edits to survive, got %+v", task)
+	}
+}
+
+func TestUpdateFull_GivesUpOnRepeatedConflicts(t *testing.T) {
+	h := newETagTaskHandler(t)
+	h.interfere = func(task *tasks.Task) bool {
+		task.Notes = fmt.Sprintf("edit %d", len(h.bodies))
+		return true
+	}
+	c := newTestTasksClient(t, h.ServeHTTP)
+
+	title := "Final"
+	_, err := c.updateFull(context.Background(), "list1", "t1", TaskUpdates{Title: &title})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+	if len(h.bodies) != maxUpdateConflicts {
+		t.Errorf("expected %d attempts, got %d", maxUpdateConflicts, len(h.bodies))
+	}
+}
+
+func TestUpdateFull_ETagConflictDuringWrite(t *testing.T) {
+	h := newETagTaskHandler(t)
+	h.interfere = func(task *tasks.Task) bool {
+		task.Title = "Renamed elsewhere"
+		return true
+	}
+	c := newTestTasksClient(t, h.ServeHTTP)
+
+	title := "Final"
+	_, err := c.updateFull(context.Background(), "list1", "t1", TaskUpdates{Title: &title, ETag: `"v1"`})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+	if len(h.bodies) != 1 {
+		t.Errorf("expected no second attempt with a pinned ETag, got %d writes", len(h.bodies))
+	}
+	if conflict.Current.Title != "Renamed elsewhere" {
+		t.Errorf("expected the concurrent edit as current version, got %+v", conflict.Current)
+	}
+}
+
+func TestUpdateFull_InvalidUpdatesOnStaleETag(t *testing.T) {
+	h := newETagTaskHandler(t)
+	h.bump()
+	c := newTestTasksClient(t, h.ServeHTTP)
+
+	due := "next week"
+	_, err := c.updateFull(context.Background(), "list1", "t1", TaskUpdates{Due: &due, ETag: `"v1"`})
+	var conflict *ConflictError
+	if err == nil || errors.As(err, &conflict) {
+		t.Fatalf("expected the invalid due date to be reported, got %v", err)
+	}
+	if len(h.bodies) != 0 {
+		t.Errorf("expected no write, got %d", len(h.bodies))
+	}
+}
+
+func TestUpdateTask_ConflictReadFails(t *testing.T) {
+	c := newTestTasksClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": 404, "message": "Task not found"}})
+			return
+		}
+		w.WriteHeader(http.StatusPreconditionFailed)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": 412, "message": "Precondition Failed"}})
+	})
+
+	title := "Final"
+	_, err := c.UpdateTask(context.Background(), "list1", "t1", TaskUpdates{Title: &title, ETag: `"v1"`})
+	if !isPreconditionFailed(err) {
+		t.Fatalf("expected the refused write to be reported, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "Task not found") {
+		t.Errorf("expected the failed read to be reported too, got %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// errReauthRequired reports that the stored refresh token no longer works and
+// the user has to authorize again
+var errReauthRequired = errors.New("Google authorization expired or was revoked, run google-tasks-mcp --auth to sign in again")
+
+// persistingTokenSource refreshes tokens through config and writes every new
+// token to store, so rotated refresh tokens survive restarts
+type persistingTokenSource struct {
+	config *oauth2.Config
+	store  tokenStore
+
+	mu   sync.Mutex
+	base oauth2.TokenSource
+	last *oauth2.Token
+}
+
+func newPersistingTokenSource(config *oauth2.Config, store tokenStore, tok *oauth2.Token) *persistingTokenSource {
+	return &persistingTokenSource{
+		config: config,
+		store:  store,
+		base:   config.TokenSource(context.Background(), tok),
+		last:   tok,
+	}
+}
+
+// Token returns a valid token, refreshing and saving it when needed
+func (p *persistingTokenSource) Token() (*oauth2.Token, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tok, err := p.base.Token()
+	if err != nil && p.reload() {
+		tok, err = p.base.Token()
+	}
+	if err != nil {
+		if isRevoked(err) {
+			return nil, fmt.Errorf("%w: %v", errReauthRequired, err)
+		}
+		return nil, err
+	}
+
+	if tok.AccessToken != p.last.AccessToken || tok.RefreshToken != p.last.RefreshToken {
+		if err := p.store.Save(tok); err != nil {
+			// Non-fatal, the token is still valid in memory
+			log.Printf("Warning: failed to save refreshed token: %v", err)
+		}
+		p.last = tok
+	}
+
+	return tok, nil
+}
+
+// reload switches to the stored token if another process has rotated the
+// refresh token since it was read, reporting whether it did
+func (p *persistingTokenSource) reload() bool {
+	stored, err := p.store.Load()
+	if err != nil || stored.RefreshToken == "" || stored.RefreshToken == p.last.RefreshToken {
+		return false
+	}
+	p.base = p.config.TokenSource(context.Background(), stored)
+	p.last = stored
+	return true
+}
+
+// isRevoked reports whether a refresh failed because the grant is no longer valid
+func isRevoked(err error) bool {
+	var re *oauth2.RetrieveError
+	return errors.As(err, &re) && re.ErrorCode == "invalid_grant"
+}
+
+const (
+	// tokenInfoURL reports the scopes and lifetime of an access token
+	tokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+
+	// revokeURL revokes a token together with the grant it belongs to
+	revokeURL = "https://oauth2.googleapis.com/revoke"
+)
+
+// authStatus writes what is known about an account's stored token to w: when
+// the access token expires, whether the refresh token still works, and the
+// scopes granted. A successful refresh is saved like any other.
+func authStatus(ctx context.Context, w io.Writer, name string, config *oauth2.Config, store tokenStore, endpoint string) error {
+	fmt.Fprintf(w, "Account: %s\n", name)
+	fmt.Fprintf(w, "Token: %s\n", store)
+
+	tok, err := store.Load()
+	if err != nil {
+		return fmt.Errorf("no token stored, run with --auth: %v", err)
+	}
+
+	switch {
+	case tok.Expiry.IsZero():
+		fmt.Fprintln(w, "Access token: no expiry recorded")
+	case tok.Expiry.Before(time.Now()):
+		fmt.Fprintf(w, "Access token: expired at %s\n", tok.Expiry.Format(time.RFC3339))
+	default:
+		fmt.Fprintf(w, "Access token: expires at %s (in %s)\n", tok.Expiry.Format(time.RFC3339), time.Until(tok.Expiry).Round(time.Minute))
+	}
+	if tok.RefreshToken == "" {
+		return fmt.Errorf("no refresh token stored, run with --auth")
+	}
+
+	// Refresh even if the access token is still valid, to prove the grant works
+	stale := *tok
+	stale.Expiry = time.Now().Add(-time.Minute)
+	fresh, err := newPersistingTokenSource(config, store, &stale).Token()
+	if err != nil {
+		fmt.Fprintln(w, "Refresh: failed")
+		return err
+	}
+	fmt.Fprintf(w, "Refresh: OK, new access token expires at %s\n", fresh.Expiry.Format(time.RFC3339))
+
+	info, err := fetchTokenInfo(ctx, endpoint, fresh.AccessToken)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Scopes: %s\n", strings.Join(strings.Fields(info.Scope), ", "))
+	// Google only reports the address to tokens granted the email scope
+	if info.Email != "" {
+		fmt.Fprintf(w, "Google account: %s\n", info.Email)
+	} else {
+		fmt.Fprintln(w, "Google account: unknown, the token wasn't granted the email scope; run --auth again to show it")
+	}
+	return nil
+}
+
+type tokenInfo struct {
+	Scope string `json:"scope"`
+	Email string `json:"email"`
+}
+
+func fetchTokenInfo(ctx context.Context, endpoint, accessToken string) (*tokenInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+url.Values{"access_token": {accessToken}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch token info: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("unable to fetch token info: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	info := &tokenInfo{}
+	if err := json.NewDecoder(resp.Body).Decode(info); err != nil {
+		return nil, fmt.Errorf("unable to parse token info: %v", err)
+	}
+	return info, nil
+}
+
+// checkReadOnlyGrant refuses a token that can change tasks, so that
+// read-only mode holds for tokens authorized before it was switched on.
+func checkReadOnlyGrant(ctx context.Context, endpoint string, tok *oauth2.Token) error {
+	// A freshly refreshed token says what it grants; a stored one has to be looked up
+	scope, _ := tok.Extra("scope").(string)
+	if scope == "" {
+		info, err := fetchTokenInfo(ctx, endpoint, tok.AccessToken)
+		if err != nil {
+			return fmt.Errorf("unable to check that the token is read-only: %v", err)
+		}
+		scope = info.Scope
+	}
+
+	if slices.Contains(strings.Fields(scope), oauthScope(false)) {
+		return fmt.Errorf("GOOGLE_TASKS_READONLY is set but the stored token may change tasks (scope %s); run google-tasks-mcp --auth again to authorize read-only access", oauthScope(false))
+	}
+	return nil
+}
+
+// logout revokes an account's grant at Google and deletes the stored token.
+// A token Google no longer knows is deleted all the same.
+func logout(ctx context.Context, w io.Writer, store tokenStore, endpoint string) error {
+	tok, err := store.Load()
+	if err != nil {
+		return fmt.Errorf("no token stored: %v", err)
+	}
+
+	// Revoking the refresh token ends the whole grant, access tokens included
+	token := tok.RefreshToken
+	if token == "" {
+		token = tok.AccessToken
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(url.Values{"token": {token}}.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to revoke token: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		fmt.Fprintln(w, "Token revoked.")
+	case resp.StatusCode == http.StatusBadRequest && strings.Contains(string(body), "invalid_token"):
+		fmt.Fprintln(w, "Token was already revoked or expired.")
+	default:
+		return fmt.Errorf("unable to revoke token: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if err := store.Delete(); err != nil {
+		return fmt.Errorf("token revoked, but unable to delete it: %v", err)
+	}
+	fmt.Fprintf(w, "Deleted: %s\n", store)
+	return nil
+}
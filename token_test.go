@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// newRefreshServer stands in for the token endpoint. It answers refreshes of
+// the refresh token it knows with a new access token and a rotated refresh
+// token, and rejects anything else as invalid_grant.
+func newRefreshServer(t *testing.T, refreshToken string) (*oauth2.Config, *int) {
+	t.Helper()
+	var mu sync.Mutex
+	current := refreshToken
+	refreshes := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		defer mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.Form.Get("refresh_token") != current {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"invalid_grant","error_description":"Token has been expired or revoked."}`)
+			return
+		}
+		refreshes++
+		current = refreshToken + "-rotated"
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access-new",
+			"refresh_token": current,
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	return &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{TokenURL: srv.URL, AuthStyle: oauth2.AuthStyleInParams},
+	}, &refreshes
+}
+
+func expiredToken(refreshToken string) *oauth2.Token {
+	return &oauth2.Token{
+		AccessToken:  "access-old",
+		TokenType:    "Bearer",
+		RefreshToken: refreshToken,
+		Expiry:       time.Now().Add(-time.Hour),
+	}
+}
+
+func TestSaveToken_Atomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token.json")
+
+	for _, access := range []string{"first", "second"} {
+		if err := saveToken(path, &oauth2.Token{AccessToken: access}); err != nil {
+			t.Fatalf("saveToken failed: %v", err)
+		}
+	}
+
+	got, err := getTokenFromFile(path)
+	if err != nil || got.AccessToken != "second" {
+		t.Errorf("expected second token, got %+v (%v)", got, err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Errorf("temp file left behind: %s", e.Name())
+		}
+	}
+}
+
+func TestPersistingTokenSource_SavesRefresh(t *testing.T) {
+	config, refreshes := newRefreshServer(t, "refresh")
+	path := filepath.Join(t.TempDir(), "token.json")
+	saveToken(path, expiredToken("refresh"))
+
+	ts := newPersistingTokenSource(config, &fileTokenStore{path: path}, expiredToken("refresh"))
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tok.AccessToken != "access-new" {
+		t.Errorf("expected refreshed token, got %+v", tok)
+	}
+
+	stored, err := getTokenFromFile(path)
+	if err != nil {
+		t.Fatalf("failed to read token: %v", err)
+	}
+	if stored.AccessToken != "access-new" || stored.RefreshToken != "refresh-rotated" {
+		t.Errorf("expected rotated token on disk, got %+v", stored)
+	}
+
+	// A valid token is reused without refreshing or rewriting
+	os.Remove(path)
+	if _, err := ts.Token(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *refreshes != 1 {
+		t.Errorf("expected 1 refresh, got %d", *refreshes)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no rewrite of an unchanged token, got %v", err)
+	}
+}
+
+func TestPersistingTokenSource_ReloadsRotatedToken(t *testing.T) {
+	config, _ := newRefreshServer(t, "refresh")
+	path := filepath.Join(t.TempDir(), "token.json")
+
+	// Another process already used our refresh token and saved the rotated one
+	ts := newPersistingTokenSource(config, &fileTokenStore{path: path}, expiredToken("stale"))
+	saveToken(path, expiredToken("refresh"))
+
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tok.AccessToken != "access-new" {
+		t.Errorf("expected refresh with the stored token, got %+v", tok)
+	}
+}
+
+func TestPersistingTokenSource_Revoked(t *testing.T) {
+	config, _ := newRefreshServer(t, "refresh")
+	path := filepath.Join(t.TempDir(), "token.json")
+	saveToken(path, expiredToken("revoked"))
+
+	ts := newPersistingTokenSource(config, &fileTokenStore{path: path}, expiredToken("revoked"))
+	_, err := ts.Token()
+	if !errors.Is(err, errReauthRequired) {
+		t.Fatalf("expected re-auth error, got %v", err)
+	}
+
+	// Tool calls failing this way tell the user to sign in again
+	client := oauth2.NewClient(context.Background(), ts)
+	_, err = client.Get("http://127.0.0.1:1/")
+	resp := newTestServer(&fakeTasks{}).errorResponse(float64(1), err)
+	if text := getResponseText(t, resp); !strings.Contains(text, "--auth") || strings.Contains(text, "127.0.0.1") {
+		t.Errorf("expected clean re-auth message, got %q", text)
+	}
+}
+
+func TestAuthStatus(t *testing.T) {
+	config, refreshes := newRefreshServer(t, "refresh")
+	info := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("access_token") != "access-new" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"invalid_token"}`)
+			return
+		}
+		io.WriteString(w, `{"scope":"https://www.googleapis.com/auth/tasks https://www.googleapis.com/auth/userinfo.email","email":"me@example.com","expires_in":"3599"}`)
+	}))
+	defer info.Close()
+
+	path := filepath.Join(t.TempDir(), "token.json")
+	store := &fileTokenStore{path: path}
+	tok := expiredToken("refresh")
+	tok.Expiry = time.Now().Add(30 * time.Minute)
+	store.Save(tok)
+
+	var out strings.Builder
+	if err := authStatus(context.Background(), &out, "work", config, store, info.URL); err != nil {
+		t.Fatalf("unexpected error: %v\n%s", err, out.String())
+	}
+
+	for _, want := range []string{"Account: work", "Token: " + path, "(in 30m0s)", "Refresh: OK", "Scopes: https://www.googleapis.com/auth/tasks, " + emailScope, "Google account: me@example.com"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in output:\n%s", want, out.String())
+		}
+	}
+	if *refreshes != 1 {
+		t.Errorf("expected a validating refresh, got %d", *refreshes)
+	}
+	if stored, _ := store.Load(); stored.RefreshToken != "refresh-rotated" {
+		t.Errorf("expected refreshed token to be saved, got %+v", stored)
+	}
+}
+
+func TestAuthStatus_NoEmailScope(t *testing.T) {
+	config, _ := newRefreshServer(t, "refresh")
+	// Tokens without the email scope carry no address
+	info := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"scope":"https://www.googleapis.com/auth/tasks","expires_in":"3599"}`)
+	}))
+	defer info.Close()
+
+	store := &fileTokenStore{path: filepath.Join(t.TempDir(), "token.json")}
+	store.Save(expiredToken("refresh"))
+
+	var out strings.Builder
+	if err := authStatus(context.Background(), &out, "work", config, store, info.URL); err != nil {
+		t.Fatalf("unexpected error: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "Google account: unknown") {
+		t.Errorf("expected the account to be reported unknown, got:\n%s", out.String())
+	}
+}
+
+func TestAuthStatus_Revoked(t *testing.T) {
+	config, _ := newRefreshServer(t, "refresh")
+	store := &fileTokenStore{path: filepath.Join(t.TempDir(), "token.json")}
+	store.Save(expiredToken("revoked"))
+
+	var out strings.Builder
+	err := authStatus(context.Background(), &out, "work", config, store, "http://127.0.0.1:1/")
+	if !errors.Is(err, errReauthRequired) {
+		t.Errorf("expected re-auth error, got %v", err)
+	}
+	if !strings.Contains(out.String(), "Access token: expired at") || !strings.Contains(out.String(), "Refresh: failed") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
+
+func TestLogout(t *testing.T) {
+	var revoked []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		revoked = append(revoked, r.Form.Get("token"))
+		if r.Form.Get("token") != "refresh" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"invalid_token","error_description":"Token expired or revoked"}`)
+		}
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		refreshToken string
+		message      string
+	}{
+		{refreshToken: "refresh", message: "Token revoked."},
+		{refreshToken: "gone", message: "already revoked"},
+	} {
+		path := filepath.Join(t.TempDir(), "token.json")
+		store := &fileTokenStore{path: path}
+		store.Save(expiredToken(tt.refreshToken))
+
+		var out strings.Builder
+		if err := logout(context.Background(), &out, store, srv.URL); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.refreshToken, err)
+		}
+		if !strings.Contains(out.String(), tt.message) {
+			t.Errorf("%s: expected %q in output:\n%s", tt.refreshToken, tt.message, out.String())
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s: expected token file to be deleted, got %v", tt.refreshToken, err)
+		}
+	}
+
+	if strings.Join(revoked, ",") != "refresh,gone" {
+		t.Errorf("expected refresh tokens to be revoked, got %v", revoked)
+	}
+}
+
+func TestLogout_RevocationFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "token.json")
+	store := &fileTokenStore{path: path}
+	store.Save(expiredToken("refresh"))
+
+	var out strings.Builder
+	if err := logout(context.Background(), &out, store, srv.URL); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected token to be kept when revocation fails, got %v", err)
+	}
+}
+
+func TestCheckReadOnlyGrant(t *testing.T) {
+	info := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("access_token") {
+		case "full":
+			io.WriteString(w, `{"scope":"https://www.googleapis.com/auth/tasks"}`)
+		case "readonly":
+			io.WriteString(w, `{"scope":"https://www.googleapis.com/auth/tasks.readonly"}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"invalid_token"}`)
+		}
+	}))
+	defer info.Close()
+
+	withScope := func(scope string) *oauth2.Token {
+		return (&oauth2.Token{AccessToken: "unknown"}).WithExtra(map[string]interface{}{"scope": scope})
+	}
+	tests := map[string]struct {
+		tok     *oauth2.Token
+		allowed bool
+	}{
+		"refreshed read-only": {withScope("https://www.googleapis.com/auth/tasks.readonly"), true},
+		"refreshed full":      {withScope("openid https://www.googleapis.com/auth/tasks"), false},
+		"stored read-only":    {&oauth2.Token{AccessToken: "readonly"}, true},
+		"stored full":         {&oauth2.Token{AccessToken: "full"}, false},
+		"unverifiable":        {&oauth2.Token{AccessToken: "unknown"}, false},
+	}
+
+	for name, tt := range tests {
+		err := checkReadOnlyGrant(context.Background(), info.URL, tt.tok)
+		if (err == nil) != tt.allowed {
+			t.Errorf("%s: expected allowed %v, got %v", name, tt.allowed, err)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	tokenStoreFile      = "file"
+	tokenStoreEncrypted = "encrypted"
+	tokenStoreCommand   = "command"
+
+	// tokenKDFIterations follows OWASP guidance for PBKDF2-HMAC-SHA256
+	tokenKDFIterations = 600000
+
+	// tokenAAD binds ciphertexts to their purpose
+	tokenAAD = "google-tasks-mcp token v1"
+)
+
+// tokenStore loads and saves one account's OAuth token.
+type tokenStore interface {
+	Load() (*oauth2.Token, error)
+	Save(tok *oauth2.Token) error
+
+	// Delete removes the stored token; it is not an error if there is none
+	Delete() error
+
+	// String describes where the token is kept, for messages
+	String() string
+}
+
+// newTokenStore returns the token store a profile is configured for.
+func newTokenStore(p profile) (tokenStore, error) {
+	switch p.Store {
+	case "", tokenStoreFile:
+		return &fileTokenStore{path: p.Token}, nil
+	case tokenStoreEncrypted:
+		passphrase := os.Getenv("GOOGLE_TOKEN_PASSPHRASE")
+		if passphrase == "" {
+			return nil, fmt.Errorf("GOOGLE_TOKEN_PASSPHRASE must be set for the encrypted token store")
+		}
+		return &encryptedTokenStore{path: p.Token, passphrase: passphrase}, nil
+	case tokenStoreCommand:
+		args := strings.Fields(p.Command)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("the command token store needs a command")
+		}
+		return &commandTokenStore{args: args, account: p.Name}, nil
+	default:
+		return nil, fmt.Errorf("unknown token store %q (expected file, encrypted or command)", p.Store)
+	}
+}
+
+// fileTokenStore keeps the token as plaintext JSON, readable only by the owner.
+type fileTokenStore struct {
+	path string
+}
+
+func (s *fileTokenStore) Load() (*oauth2.Token, error) {
+	return getTokenFromFile(s.path)
+}
+
+func (s *fileTokenStore) Save(tok *oauth2.Token) error {
+	return saveToken(s.path, tok)
+}
+
+func (s *fileTokenStore) Delete() error {
+	return removeIfExists(s.path)
+}
+
+func (s *fileTokenStore) String() string {
+	return s.path
+}
+
+// encryptedTokenStore keeps the token in a file encrypted with AES-256-GCM
+// under a key derived from a passphrase with PBKDF2. A plaintext token found
+// at the path is encrypted in place on first load.
+type encryptedTokenStore struct {
+	path       string
+	passphrase string
+
+	// iterations overrides tokenKDFIterations for new files
+	iterations int
+}
+
+// encryptedToken is the on-disk format of encryptedTokenStore.
+type encryptedToken struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func (s *encryptedTokenStore) Load() (*oauth2.Token, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var sealed encryptedToken
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		return nil, fmt.Errorf("unable to parse token file: %v", err)
+	}
+	if sealed.Ciphertext == nil {
+		return s.migrate(data)
+	}
+	if sealed.Version != 1 || sealed.KDF != "pbkdf2-sha256" {
+		return nil, fmt.Errorf("unsupported token file format (version %d, kdf %q)", sealed.Version, sealed.KDF)
+	}
+
+	gcm, err := tokenCipher(s.passphrase, sealed.Salt, sealed.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, sealed.Nonce, sealed.Ciphertext, []byte(tokenAAD))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt token, wrong GOOGLE_TOKEN_PASSPHRASE?")
+	}
+
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal(plaintext, tok); err != nil {
+		return nil, fmt.Errorf("unable to parse decrypted token: %v", err)
+	}
+	return tok, nil
+}
+
+// migrate encrypts a plaintext token file left over from the file store.
+func (s *encryptedTokenStore) migrate(data []byte) (*oauth2.Token, error) {
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal(data, tok); err != nil || (tok.AccessToken == "" && tok.RefreshToken == "") {
+		return nil, fmt.Errorf("token file %s is neither encrypted nor a plaintext token", s.path)
+	}
+	if err := s.Save(tok); err != nil {
+		return nil, fmt.Errorf("unable to encrypt plaintext token: %v", err)
+	}
+	log.Printf("Encrypted plaintext token file %s", s.path)
+	return tok, nil
+}
+
+func (s *encryptedTokenStore) Save(tok *oauth2.Token) error {
+	plaintext, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+
+	iterations := s.iterations
+	if iterations == 0 {
+		iterations = tokenKDFIterations
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	gcm, err := tokenCipher(s.passphrase, salt, iterations)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(encryptedToken{
+		Version:    1,
+		KDF:        "pbkdf2-sha256",
+		Iterations: iterations,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, []byte(tokenAAD)),
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("unable to save token: %v", err)
+	}
+	return nil
+}
+
+func (s *encryptedTokenStore) Delete() error {
+	return removeIfExists(s.path)
+}
+
+func (s *encryptedTokenStore) String() string {
+	return s.path + " (encrypted)"
+}
+
+func tokenCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// commandTokenStore delegates to an external helper, in the style of git
+// credential helpers: "<command> get <account>" prints the token JSON,
+// "<command> store <account>" reads it from stdin and "<command> erase
+// <account>" forgets it.
+type commandTokenStore struct {
+	args    []string
+	account string
+}
+
+func (s *commandTokenStore) Load() (*oauth2.Token, error) {
+	out, err := s.run("get", nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, errors.New("token helper has no token stored")
+	}
+
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal(out, tok); err != nil {
+		return nil, fmt.Errorf("unable to parse token from helper: %v", err)
+	}
+	return tok, nil
+}
+
+func (s *commandTokenStore) Save(tok *oauth2.Token) error {
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	_, err = s.run("store", data)
+	return err
+}
+
+func (s *commandTokenStore) Delete() error {
+	_, err := s.run("erase", nil)
+	return err
+}
+
+func (s *commandTokenStore) String() string {
+	return fmt.Sprintf("token helper %q", strings.Join(s.args, " "))
+}
+
+func (s *commandTokenStore) run(action string, stdin []byte) ([]byte, error) {
+	args := append(append([]string{}, s.args[1:]...), action, s.account)
+	cmd := exec.Command(s.args[0], args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("token helper %s failed: %v: %s", action, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// migrateToken moves a plaintext token file into the profile's token store,
+// removing the plaintext copy when the store keeps the token elsewhere.
+func migrateToken(p profile, store tokenStore) error {
+	if _, ok := store.(*fileTokenStore); ok {
+		return fmt.Errorf("account %q uses the plaintext file store, nothing to migrate", p.Name)
+	}
+
+	tok, err := getTokenFromFile(p.Token)
+	if err != nil {
+		return fmt.Errorf("unable to read plaintext token: %v", err)
+	}
+	if tok.AccessToken == "" && tok.RefreshToken == "" {
+		return fmt.Errorf("%s is not a plaintext token, already migrated?", p.Token)
+	}
+	if err := store.Save(tok); err != nil {
+		return err
+	}
+
+	// The encrypted store has already overwritten the plaintext file in place
+	if _, ok := store.(*commandTokenStore); ok {
+		if err := os.Remove(p.Token); err != nil {
+			return fmt.Errorf("token migrated, but unable to remove plaintext file: %v", err)
+		}
+	}
+	return nil
+}
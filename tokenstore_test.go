@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestEncryptedTokenStore_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	store := &encryptedTokenStore{path: path, passphrase: "secret", iterations: 1000}
+
+	if err := store.Save(&oauth2.Token{AccessToken: "access", RefreshToken: "refresh-456"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "refresh-456") {
+		t.Errorf("token file contains the plaintext refresh token: %s", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("expected permissions 0600, got %o", info.Mode().Perm())
+	}
+
+	tok, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if tok.RefreshToken != "refresh-456" {
+		t.Errorf("expected refresh token back, got %+v", tok)
+	}
+
+	wrong := &encryptedTokenStore{path: path, passphrase: "guess"}
+	if _, err := wrong.Load(); err == nil || !strings.Contains(err.Error(), "GOOGLE_TOKEN_PASSPHRASE") {
+		t.Errorf("expected decryption failure, got %v", err)
+	}
+}
+
+func TestEncryptedTokenStore_MigratesPlaintext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	saveToken(path, &oauth2.Token{AccessToken: "access", RefreshToken: "refresh-456"})
+
+	store := &encryptedTokenStore{path: path, passphrase: "secret", iterations: 1000}
+	tok, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if tok.RefreshToken != "refresh-456" {
+		t.Errorf("expected plaintext token, got %+v", tok)
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "refresh-456") || !strings.Contains(string(data), "ciphertext") {
+		t.Errorf("expected file to be encrypted in place, got: %s", data)
+	}
+}
+
+// writeTokenHelper creates a helper script that keeps tokens in dir, one file per account.
+func writeTokenHelper(t *testing.T) (string, string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("token helper script needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	helper := filepath.Join(dir, "helper.sh")
+	script := `#!/bin/sh
+case "$2" in
+get) cat "$1/$3" 2>/dev/null ;;
+store) cat > "$1/$3" ;;
+erase) rm -f "$1/$3" ;;
+*) echo "unknown action $2" >&2; exit 1 ;;
+esac
+`
+	if err := os.WriteFile(helper, []byte(script), 0700); err != nil {
+		t.Fatalf("failed to write helper: %v", err)
+	}
+	return helper + " " + dir, dir
+}
+
+func TestCommandTokenStore(t *testing.T) {
+	command, dir := writeTokenHelper(t)
+	store, err := newTokenStore(profile{Name: "work", Store: tokenStoreCommand, Command: command})
+	if err != nil {
+		t.Fatalf("newTokenStore failed: %v", err)
+	}
+
+	if _, err := store.Load(); err == nil {
+		t.Error("expected error before a token is stored")
+	}
+
+	if err := store.Save(&oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "work")); err != nil {
+		t.Errorf("expected helper to store the token under the account name: %v", err)
+	}
+
+	tok, err := store.Load()
+	if err != nil || tok.RefreshToken != "refresh" {
+		t.Errorf("expected stored token, got %+v (%v)", tok, err)
+	}
+}
+
+func TestMigrateToken_ToCommandStore(t *testing.T) {
+	command, _ := writeTokenHelper(t)
+	tokenFile := filepath.Join(t.TempDir(), "token.json")
+	saveToken(tokenFile, &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"})
+
+	p := profile{Name: "work", Token: tokenFile, Store: tokenStoreCommand, Command: command}
+	store, _ := newTokenStore(p)
+	if err := migrateToken(p, store); err != nil {
+		t.Fatalf("migrateToken failed: %v", err)
+	}
+
+	if tok, err := store.Load(); err != nil || tok.RefreshToken != "refresh" {
+		t.Errorf("expected token in helper, got %+v (%v)", tok, err)
+	}
+	if _, err := os.Stat(tokenFile); !os.IsNotExist(err) {
+		t.Errorf("expected plaintext file to be removed, got %v", err)
+	}
+}
+
+func TestMigrateToken_ToEncryptedStore(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token.json")
+	saveToken(tokenFile, &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"})
+
+	p := profile{Name: "default", Token: tokenFile, Store: tokenStoreEncrypted}
+	store := &encryptedTokenStore{path: tokenFile, passphrase: "secret", iterations: 1000}
+	if err := migrateToken(p, store); err != nil {
+		t.Fatalf("migrateToken failed: %v", err)
+	}
+	if tok, err := store.Load(); err != nil || tok.RefreshToken != "refresh" {
+		t.Errorf("expected encrypted token, got %+v (%v)", tok, err)
+	}
+
+	if err := migrateToken(p, store); err == nil || !strings.Contains(err.Error(), "already migrated") {
+		t.Errorf("expected second migration to fail, got %v", err)
+	}
+}
+
+func TestNewTokenStore_Errors(t *testing.T) {
+	t.Setenv("GOOGLE_TOKEN_PASSPHRASE", "")
+
+	for _, p := range []profile{
+		{Store: tokenStoreEncrypted, Token: "token.json"},
+		{Store: tokenStoreCommand},
+		{Store: "keychain"},
+	} {
+		if _, err := newTokenStore(p); err == nil {
+			t.Errorf("%+v: expected error", p)
+		}
+	}
+}